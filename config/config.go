@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv" // Needed for parsing integers
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,11 +23,105 @@ type DatabaseConfig struct {
 	DSN      string // Data Source Name for GORM
 }
 
+// MailConfig holds outgoing mail configuration
+type MailConfig struct {
+	Driver   string // "log" (default) or "file"
+	From     string
+	FilePath string // Target file for the "file" driver
+}
+
+// PasswordPolicyConfig holds the rules new passwords must satisfy
+type PasswordPolicyConfig struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	BreachedPath  string // Offline breached-password list (range directory or hash file); empty disables the check
+}
+
+// PasswordHashConfig selects the algorithm and cost used for new password hashes.
+// Stored hashes using anything else are upgraded on the user's next login.
+type PasswordHashConfig struct {
+	Algorithm         string // "argon2id" or "bcrypt"
+	BcryptCost        int
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+// LockoutConfig controls brute-force protection on /login
+type LockoutConfig struct {
+	Threshold     int           // Failed attempts per account before it is locked
+	BaseDuration  time.Duration // First lockout; doubles with every further lockout
+	MaxDuration   time.Duration // Upper bound for a single lockout
+	ResetAfter    time.Duration // Quiet period after which an account's lockout history is forgotten
+	IPMaxAttempts int           // Failed attempts allowed per client IP within IPWindow
+	IPWindow      time.Duration
+}
+
+// OIDCConfig configures login through an external OpenID Connect provider.
+// The feature is disabled while Issuer is empty.
+type OIDCConfig struct {
+	Issuer        string // Issuer URL; the discovery document is read from <Issuer>/.well-known/openid-configuration
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string   // Callback registered at the provider
+	Scopes        []string // Requested scopes; "openid" is always included
+	AutoProvision bool     // Create local users for unknown identities on first login
+	LinkExisting  bool     // Link identities to existing users with the same, provider-verified email
+	DefaultRole   string   // Role given to provisioned users
+}
+
+// JWTKey is a retired signing key that is still accepted for verification
+// until ExpiresAt, so tokens signed before a rotation keep working.
+// HS256 keys carry a Secret; RS256/EdDSA keys point at a PEM KeyFile.
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	Secret    string
+	KeyFile   string
+	ExpiresAt time.Time
+}
+
 // AppConfiguration holds all application-wide configuration
 type AppConfiguration struct {
-	Port      string // Changed to string to directly use os.Getenv result for router.Run
-	JWTSecret string
-	Database  DatabaseConfig
+	Port              string        // Changed to string to directly use os.Getenv result for router.Run
+	TrustedProxies    []string      // Proxies (IPs or CIDRs) whose X-Forwarded-For headers are believed
+	JWTAlgorithm      string        // HS256, RS256 or EdDSA
+	JWTSecret         string        // HMAC secret, used with HS256
+	JWTPrivateKeyFile string        // PEM private key, used with RS256/EdDSA
+	JWTKeyID          string        // kid stamped on newly signed tokens
+	JWTRetiredKeys    []JWTKey      // Previous keys still valid for verification during their grace period
+	AccessTokenTTL    time.Duration // Lifetime of signed access tokens
+	RefreshTokenTTL   time.Duration // Lifetime of persisted refresh tokens
+	PasswordResetTTL  time.Duration // Lifetime of password reset links
+	ImpersonationTTL  time.Duration // Lifetime of admin impersonation tokens
+	InvitationTTL     time.Duration // Default lifetime of sign-up and organization invitations
+
+	OpenRegistration         bool          // Let anyone register via POST /users; otherwise an invitation is required
+	RequireEmailVerification bool          // Block login until the address is verified
+	EmailVerificationTTL     time.Duration // Lifetime of verification links
+
+	MFAIssuer         string        // Issuer label shown in authenticator apps
+	MFARequiredRoles  []string      // Roles that must complete TOTP to use role-restricted routes
+	MFAForPermissions bool          // Require TOTP from sessions that use any elevated permission
+	MFAPendingTTL     time.Duration // Time allowed between password check and TOTP code
+	MFAMaxAttempts    int           // Wrong codes after which an MFA pending token is invalidated
+
+	OAuthCodeTTL time.Duration // Lifetime of OAuth2 authorization codes
+	OIDC         OIDCConfig
+
+	AuditHashChain bool // Chain audit events by hash so tampering is detectable
+
+	BaseURL          string // Public base URL used to build links in emails
+	PasswordResetURL string // Frontend page that takes a reset token as ?token=; empty to mail the token with API instructions
+	Mail             MailConfig
+	Lockout          LockoutConfig
+
+	PasswordPolicy PasswordPolicyConfig
+	PasswordHash   PasswordHashConfig
+	Database       DatabaseConfig
 }
 
 // AppConfig is the global instance of your application's configuration
@@ -50,10 +147,275 @@ func LoadConfig() error {
 		// return fmt.Errorf("PORT environment variable not set")
 	}
 
-	// --- Load JWT Secret ---
-	AppConfig.JWTSecret = os.Getenv("JWT_SECRET")
-	if AppConfig.JWTSecret == "" {
-		return fmt.Errorf("JWT_SECRET environment variable not set. Please set a strong, random secret")
+	// Without trusted proxies the client IP is the connection's remote address
+	AppConfig.TrustedProxies = getEnvList("TRUSTED_PROXIES", nil)
+
+	// --- Load JWT Signing Key ---
+	AppConfig.JWTAlgorithm = os.Getenv("JWT_ALGORITHM")
+	if AppConfig.JWTAlgorithm == "" {
+		AppConfig.JWTAlgorithm = "HS256"
+	}
+
+	switch AppConfig.JWTAlgorithm {
+	case "HS256":
+		AppConfig.JWTSecret = os.Getenv("JWT_SECRET")
+		if AppConfig.JWTSecret == "" {
+			return fmt.Errorf("JWT_SECRET environment variable not set. Please set a strong, random secret")
+		}
+	case "RS256", "EdDSA":
+		AppConfig.JWTPrivateKeyFile = os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if AppConfig.JWTPrivateKeyFile == "" {
+			return fmt.Errorf("JWT_PRIVATE_KEY_FILE environment variable not set. It is required for %s", AppConfig.JWTAlgorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM '%s': use HS256, RS256 or EdDSA", AppConfig.JWTAlgorithm)
+	}
+
+	AppConfig.JWTKeyID = os.Getenv("JWT_KEY_ID")
+	if AppConfig.JWTKeyID == "" {
+		AppConfig.JWTKeyID = "primary"
+	}
+
+	AppConfig.JWTRetiredKeys, err = loadRetiredKeys()
+	if err != nil {
+		return err
+	}
+
+	// --- Load Token Lifetimes ---
+	AppConfig.AccessTokenTTL, err = getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.RefreshTokenTTL, err = getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordResetTTL, err = getEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.ImpersonationTTL, err = getEnvDuration("IMPERSONATION_TTL", 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.InvitationTTL, err = getEnvDuration("INVITATION_TTL", 7*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Registration ---
+	AppConfig.OpenRegistration, err = getEnvBool("OPEN_REGISTRATION", true)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Email Verification ---
+	AppConfig.RequireEmailVerification, err = getEnvBool("REQUIRE_EMAIL_VERIFICATION", false)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.EmailVerificationTTL, err = getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Two-Factor Authentication ---
+	AppConfig.MFAIssuer = os.Getenv("MFA_ISSUER")
+	if AppConfig.MFAIssuer == "" {
+		AppConfig.MFAIssuer = "Golang API"
+	}
+
+	AppConfig.MFARequiredRoles = getEnvList("MFA_REQUIRED_ROLES", []string{"admin"})
+
+	AppConfig.MFAForPermissions, err = getEnvBool("MFA_REQUIRED_FOR_PERMISSIONS", true)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.MFAPendingTTL, err = getEnvDuration("MFA_PENDING_TTL", 5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.MFAMaxAttempts, err = getEnvInt("MFA_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return err
+	}
+
+	// --- Load OAuth2 Authorization Server ---
+	AppConfig.OAuthCodeTTL, err = getEnvDuration("OAUTH_CODE_TTL", 10*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Audit Log ---
+	AppConfig.AuditHashChain, err = getEnvBool("AUDIT_HASH_CHAIN", false)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Login Lockout ---
+	AppConfig.Lockout.Threshold, err = getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.Lockout.BaseDuration, err = getEnvDuration("LOGIN_LOCKOUT_BASE", time.Minute)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.Lockout.MaxDuration, err = getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.Lockout.ResetAfter, err = getEnvDuration("LOGIN_LOCKOUT_RESET_AFTER", 24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.Lockout.IPMaxAttempts, err = getEnvInt("LOGIN_IP_MAX_ATTEMPTS", 50)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.Lockout.IPWindow, err = getEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	// --- Load Password Policy ---
+	AppConfig.PasswordPolicy.MinLength, err = getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordPolicy.RequireUpper, err = getEnvBool("PASSWORD_REQUIRE_UPPER", false)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordPolicy.RequireLower, err = getEnvBool("PASSWORD_REQUIRE_LOWER", false)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordPolicy.RequireDigit, err = getEnvBool("PASSWORD_REQUIRE_DIGIT", false)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordPolicy.RequireSymbol, err = getEnvBool("PASSWORD_REQUIRE_SYMBOL", false)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.PasswordPolicy.BreachedPath = os.Getenv("BREACHED_PASSWORDS_PATH")
+	if AppConfig.PasswordPolicy.BreachedPath != "" {
+		if _, err := os.Stat(AppConfig.PasswordPolicy.BreachedPath); err != nil {
+			return fmt.Errorf("BREACHED_PASSWORDS_PATH '%s' is not readable: %w", AppConfig.PasswordPolicy.BreachedPath, err)
+		}
+	}
+
+	// --- Load Password Hashing ---
+	AppConfig.PasswordHash.Algorithm = os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if AppConfig.PasswordHash.Algorithm == "" {
+		AppConfig.PasswordHash.Algorithm = "argon2id"
+	}
+	if AppConfig.PasswordHash.Algorithm != "argon2id" && AppConfig.PasswordHash.Algorithm != "bcrypt" {
+		return fmt.Errorf("unsupported PASSWORD_HASH_ALGORITHM '%s': use argon2id or bcrypt", AppConfig.PasswordHash.Algorithm)
+	}
+
+	AppConfig.PasswordHash.BcryptCost, err = getEnvInt("BCRYPT_COST", 10)
+	if err != nil {
+		return err
+	}
+
+	argon2Memory, err := getEnvInt("ARGON2_MEMORY_KIB", 64*1024)
+	if err != nil {
+		return err
+	}
+	argon2Iterations, err := getEnvInt("ARGON2_ITERATIONS", 3)
+	if err != nil {
+		return err
+	}
+	argon2Parallelism, err := getEnvInt("ARGON2_PARALLELISM", 2)
+	if err != nil {
+		return err
+	}
+	if argon2Memory < 8*1024 || argon2Iterations < 1 || argon2Parallelism < 1 || argon2Parallelism > 255 {
+		return fmt.Errorf("invalid Argon2 parameters: memory must be at least 8192 KiB, iterations at least 1, parallelism between 1 and 255")
+	}
+	AppConfig.PasswordHash.Argon2Memory = uint32(argon2Memory)
+	AppConfig.PasswordHash.Argon2Iterations = uint32(argon2Iterations)
+	AppConfig.PasswordHash.Argon2Parallelism = uint8(argon2Parallelism)
+
+	// --- Load Mail Configuration ---
+	AppConfig.BaseURL = strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	if AppConfig.BaseURL == "" {
+		AppConfig.BaseURL = "http://localhost:" + AppConfig.Port
+	}
+
+	AppConfig.PasswordResetURL = os.Getenv("PASSWORD_RESET_URL")
+	if AppConfig.PasswordResetURL != "" {
+		if u, err := url.Parse(AppConfig.PasswordResetURL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("PASSWORD_RESET_URL must be an absolute URL")
+		}
+	}
+
+	AppConfig.Mail.Driver = os.Getenv("MAIL_DRIVER")
+	if AppConfig.Mail.Driver == "" {
+		AppConfig.Mail.Driver = "log"
+	}
+	AppConfig.Mail.From = os.Getenv("MAIL_FROM")
+	if AppConfig.Mail.From == "" {
+		AppConfig.Mail.From = "no-reply@localhost"
+	}
+	switch AppConfig.Mail.Driver {
+	case "log":
+	case "file":
+		AppConfig.Mail.FilePath = os.Getenv("MAIL_FILE_PATH")
+		if AppConfig.Mail.FilePath == "" {
+			return fmt.Errorf("MAIL_FILE_PATH environment variable not set. It is required for the file mail driver")
+		}
+	default:
+		return fmt.Errorf("unsupported MAIL_DRIVER '%s': use log or file", AppConfig.Mail.Driver)
+	}
+
+	// --- Load OpenID Connect Login ---
+	AppConfig.OIDC.Issuer = os.Getenv("OIDC_ISSUER")
+	AppConfig.OIDC.ClientID = os.Getenv("OIDC_CLIENT_ID")
+	AppConfig.OIDC.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	if AppConfig.OIDC.Issuer != "" && AppConfig.OIDC.ClientID == "" {
+		return fmt.Errorf("OIDC_CLIENT_ID environment variable not set. It is required when OIDC_ISSUER is set")
+	}
+
+	AppConfig.OIDC.RedirectURL = os.Getenv("OIDC_REDIRECT_URL")
+	if AppConfig.OIDC.RedirectURL == "" {
+		AppConfig.OIDC.RedirectURL = AppConfig.BaseURL + "/auth/oidc/callback"
+	}
+
+	AppConfig.OIDC.Scopes = getEnvList("OIDC_SCOPES", []string{"openid", "email", "profile"})
+
+	AppConfig.OIDC.AutoProvision, err = getEnvBool("OIDC_AUTO_PROVISION", true)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.OIDC.LinkExisting, err = getEnvBool("OIDC_LINK_EXISTING", true)
+	if err != nil {
+		return err
+	}
+
+	AppConfig.OIDC.DefaultRole = os.Getenv("OIDC_DEFAULT_ROLE")
+	if AppConfig.OIDC.DefaultRole == "" {
+		AppConfig.OIDC.DefaultRole = "user"
 	}
 
 	// --- Load Database Configuration ---
@@ -110,3 +472,113 @@ func LoadConfig() error {
 	log.Println("Configuration loaded successfully.")
 	return nil
 }
+
+// getEnvDuration reads a duration such as "15m" or "720h" from the environment,
+// falling back to def when the variable is not set.
+func getEnvDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s '%s': %w", key, value, err)
+	}
+	return d, nil
+}
+
+// loadRetiredKeys reads rotated-out signing keys. JWT_RETIRED_KEYS lists their kids
+// (comma-separated); each kid needs JWT_RETIRED_KEY_<KID> holding the HMAC secret
+// or PEM key file path and JWT_RETIRED_KEY_<KID>_EXPIRES holding the RFC 3339 end
+// of its grace period. JWT_RETIRED_KEY_<KID>_ALGORITHM defaults to JWT_ALGORITHM,
+// which allows migrating between algorithms without logging everyone out.
+func loadRetiredKeys() ([]JWTKey, error) {
+	var keys []JWTKey
+	for _, kid := range strings.Split(os.Getenv("JWT_RETIRED_KEYS"), ",") {
+		kid = strings.TrimSpace(kid)
+		if kid == "" {
+			continue
+		}
+		if kid == AppConfig.JWTKeyID {
+			return nil, fmt.Errorf("retired JWT key '%s' has the same kid as the active key", kid)
+		}
+
+		envKey := "JWT_RETIRED_KEY_" + strings.ToUpper(kid)
+		value := os.Getenv(envKey)
+		if value == "" {
+			return nil, fmt.Errorf("%s environment variable not set", envKey)
+		}
+
+		key := JWTKey{ID: kid, Algorithm: os.Getenv(envKey + "_ALGORITHM")}
+		if key.Algorithm == "" {
+			key.Algorithm = AppConfig.JWTAlgorithm
+		}
+		switch key.Algorithm {
+		case "HS256":
+			key.Secret = value
+		case "RS256", "EdDSA":
+			key.KeyFile = value
+		default:
+			return nil, fmt.Errorf("unsupported algorithm '%s' for retired JWT key '%s'", key.Algorithm, kid)
+		}
+
+		expiresStr := os.Getenv(envKey + "_EXPIRES")
+		if expiresStr == "" {
+			return nil, fmt.Errorf("%s_EXPIRES environment variable not set", envKey)
+		}
+		expiresAt, err := time.Parse(time.RFC3339, expiresStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s_EXPIRES '%s': %w", envKey, expiresStr, err)
+		}
+		key.ExpiresAt = expiresAt
+
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// getEnvInt reads an integer from the environment, falling back to def when the variable is not set.
+func getEnvInt(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s '%s': %w", key, value, err)
+	}
+	return n, nil
+}
+
+// getEnvBool reads a boolean such as "true" or "0" from the environment,
+// falling back to def when the variable is not set.
+func getEnvBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("error parsing %s '%s': %w", key, value, err)
+	}
+	return b, nil
+}
+
+// getEnvList reads a comma-separated list from the environment, falling back to
+// def when the variable is not set. Set it to "none" for an explicitly empty list.
+func getEnvList(key string, def []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	if value == "none" {
+		return nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/services"
+	"gocheck/utils"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// APIKeyController handles personal API key management
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyController creates a new APIKeyController
+func NewAPIKeyController(db *gorm.DB) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: services.NewAPIKeyService(db),
+	}
+}
+
+// CreateAPIKeyRequest is the payload accepted by POST /api-keys
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; omit for a key that does not expire
+}
+
+// APIKeyResponse describes an API key without its secret
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse is returned once, when a key is created
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"` // The full key; it cannot be retrieved again
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a personal API key for machine clients. The key is only shown in this response. Send it as "X-API-Key: KEY" or "Authorization: ApiKey KEY".
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "Key name, scopes and optional expiry"
+// @Success 201 {object} CreatedAPIKeyResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /api-keys [post]
+
+func (kc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	// A leaked key or a third-party client's token must not be able to mint
+	// further keys, which would outlive revoking the key or client
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// A scoped session cannot mint a key with more power than it has itself
+	if scopes, limited := middleware.Scopes(c); limited && !utils.ScopesAllowed(req.Scopes, scopes) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Requested scopes exceed those of the current token"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	key, rawKey, err := kc.apiKeyService.CreateKey(userID, middleware.OrganizationID(c), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, utils.ErrUnknownScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "known_scopes": utils.KnownScopes})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreatedAPIKeyResponse{APIKeyResponse: toAPIKeyResponse(key), Key: rawKey})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the current user's API keys, including revoked and expired ones
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} APIKeyResponse
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /api-keys [get]
+
+func (kc *APIKeyController) ListAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	keys, err := kc.apiKeyService.ListKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	response := make([]APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = toAPIKeyResponse(&keys[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Tags api-keys
+// @Param id path int true "API key ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /api-keys/{id} [delete]
+
+func (kc *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := kc.apiKeyService.RevokeKey(userID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// toAPIKeyResponse converts a key record into its public representation
+func toAPIKeyResponse(key *models.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"gocheck/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeysAreFirstPartyOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// The requests are refused before the database is touched
+	kc := NewAPIKeyController(nil)
+
+	credentials := map[string]gin.HandlerFunc{
+		"API key": func(c *gin.Context) {
+			c.Set("userID", uint(1))
+			c.Set("apiKeyID", uint(2))
+		},
+		"OAuth2 client token": func(c *gin.Context) {
+			c.Set("userID", uint(1))
+			c.Set("claims", &utils.Claims{UserID: 1, ClientID: "third-party", Scope: "users:write"})
+		},
+	}
+	for name, auth := range credentials {
+		router := gin.New()
+		router.Use(auth)
+		router.POST("/api-keys", kc.CreateAPIKey)
+		router.DELETE("/api-keys/:id", kc.RevokeAPIKey)
+
+		requests := []*http.Request{
+			httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name":"backdoor"}`)),
+			httptest.NewRequest(http.MethodDelete, "/api-keys/1", nil),
+		}
+		for _, req := range requests {
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s: %s %s = %d, want %d", name, req.Method, req.URL.Path, w.Code, http.StatusForbidden)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/services"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditActor describes the caller for audited service mutations: the authenticated
+// user, the real admin behind them during impersonation, and where the request came from
+func auditActor(c *gin.Context) services.AuditActor {
+	actor := services.AuditActor{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: middleware.GetRequestID(c),
+	}
+	actor.UserID, _ = currentUserID(c)
+	if impersonatorID, ok := middleware.ImpersonatorID(c); ok {
+		actor.ImpersonatorID = &impersonatorID
+	}
+	return actor
+}
+
+// newAuditEvent builds an audit event for the current request, attributed to the caller
+func newAuditEvent(c *gin.Context, action, targetType, targetID, outcome, detail string) *models.AuditEvent {
+	actor := auditActor(c)
+	return &models.AuditEvent{
+		ActorID:        actor.UserID,
+		ImpersonatorID: actor.ImpersonatorID,
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       targetID,
+		Outcome:        outcome,
+		Detail:         detail,
+		IP:             actor.IP,
+		UserAgent:      actor.UserAgent,
+		RequestID:      actor.RequestID,
+	}
+}
+
+// recordAudit appends an event to the audit trail. Failures are logged rather
+// than failing the request.
+func recordAudit(auditService *services.AuditService, event *models.AuditEvent) {
+	if err := auditService.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s on %s %s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
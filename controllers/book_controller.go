@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"gocheck/middleware"
 	"gocheck/models"
 	"gocheck/services"
 	"net/http"
@@ -12,25 +14,41 @@ import (
 
 // BookController handles book-related HTTP requests
 type BookController struct {
+	db          *gorm.DB
 	bookService *services.BookService
 }
 
 // NewBookController creates a new BookController
 func NewBookController(db *gorm.DB) *BookController {
 	return &BookController{
+		db:          db,
 		bookService: services.NewBookService(db),
 	}
 }
 
-// CreateBook handles creating a new book
+// BookRequest is the payload accepted when creating or updating a book.
+// The owner is always the authenticated caller and cannot be set by the client.
+type BookRequest struct {
+	Title  string `json:"title" binding:"required"`
+	Author string `json:"author"`
+}
+
+// CreateBook handles creating a new book owned by the caller
 func (bc *BookController) CreateBook(c *gin.Context) {
-	var book models.Book
-	if err := c.ShouldBindJSON(&book); err != nil {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req BookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	createdBook, err := bc.bookService.CreateBook(&book)
+	book := models.Book{Title: req.Title, Author: req.Author, UserID: userID}
+	createdBook, err := bc.books(c).CreateBook(&book)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
 		return
@@ -41,29 +59,34 @@ func (bc *BookController) CreateBook(c *gin.Context) {
 
 // GetBookByID fetches a single book by ID
 func (bc *BookController) GetBookByID(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
-		return
-	}
-
-	book, err := bc.bookService.GetBookByID(uint(id))
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+	book, ok := bc.authorizedBook(c, "")
+	if !ok {
 		return
 	}
 
 	c.JSON(http.StatusOK, book)
 }
 
-// GetAllBooks fetches all books
+// GetAllBooks fetches the caller's books, or every book of the organization for users with books:read
 func (bc *BookController) GetAllBooks(c *gin.Context) {
-	books, err := bc.bookService.GetAllBooks()
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	readAll, err := middleware.HasElevatedPermission(c, bc.db, "books:read")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+
+	var books []models.Book
+	if readAll {
+		books, err = bc.books(c).GetAllBooks()
+	} else {
+		books, err = bc.books(c).GetBooksByUserID(userID)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
 		return
@@ -72,23 +95,23 @@ func (bc *BookController) GetAllBooks(c *gin.Context) {
 	c.JSON(http.StatusOK, books)
 }
 
-// UpdateBook updates a book
+// UpdateBook updates a book owned by the caller, or any book with books:update
 func (bc *BookController) UpdateBook(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+	book, ok := bc.authorizedBook(c, "books:update")
+	if !ok {
 		return
 	}
 
-	var book models.Book
-	if err := c.ShouldBindJSON(&book); err != nil {
+	var req BookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	book.ID = uint(id) // Make sure ID is from URL
-	updatedBook, err := bc.bookService.UpdateBook(&book)
+	// Only the details change; ID and owner stay as stored
+	book.Title = req.Title
+	book.Author = req.Author
+	updatedBook, err := bc.books(c).UpdateBook(book)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update book"})
 		return
@@ -97,19 +120,79 @@ func (bc *BookController) UpdateBook(c *gin.Context) {
 	c.JSON(http.StatusOK, updatedBook)
 }
 
-// DeleteBook deletes a book by ID
+// DeleteBook deletes a book owned by the caller, or any book with books:delete
 func (bc *BookController) DeleteBook(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+	book, ok := bc.authorizedBook(c, "books:delete")
+	if !ok {
 		return
 	}
 
-	if err := bc.bookService.DeleteBook(uint(id)); err != nil {
+	if err := bc.books(c).DeleteBook(book.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book"})
 		return
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// authorizedBook loads the book named in the URL and checks the caller may act on it,
+// writing the error response itself when not. Owners may do anything with their books.
+// Other users' books are reported as 404 unless the caller holds books:read, so their
+// existence is not leaked; a visible book the caller may not modify (lacking the
+// permission, when one is given) is a 403.
+func (bc *BookController) authorizedBook(c *gin.Context, permission string) (*models.Book, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return nil, false
+	}
+
+	book, err := bc.books(c).GetBookByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch book"})
+		return nil, false
+	}
+	if book.UserID == userID {
+		return book, true
+	}
+
+	canRead, err := middleware.HasElevatedPermission(c, bc.db, "books:read")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return nil, false
+	}
+	if !canRead {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return nil, false
+	}
+	if permission == "" {
+		return book, true
+	}
+
+	allowed, err := middleware.HasElevatedPermission(c, bc.db, permission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: you do not own this book"})
+		return nil, false
+	}
+	return book, true
+}
+
+// books returns the book service for the request: confined to the caller's
+// organization and auditing mutations as the caller
+func (bc *BookController) books(c *gin.Context) *services.BookService {
+	return bc.bookService.WithActor(auditActor(c)).WithTenant(middleware.OrganizationID(c))
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"gocheck/models"
+	"gocheck/testdb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// bookRouter mounts the book handlers behind a stand-in for AuthMiddleware that
+// authenticates the user named in the X-Test-User header with a second factor
+func bookRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	bc := NewBookController(db)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.GetHeader("X-Test-User"), 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Set("userID", uint(id))
+		c.Set("mfa", true)
+		c.Next()
+	})
+	router.POST("/books", bc.CreateBook)
+	router.GET("/books", bc.GetAllBooks)
+	router.GET("/books/:id", bc.GetBookByID)
+	router.PUT("/books/:id", bc.UpdateBook)
+	router.DELETE("/books/:id", bc.DeleteBook)
+	return router
+}
+
+func doBookRequest(t *testing.T, router *gin.Engine, method, path string, user *models.User, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", strconv.FormatUint(uint64(user.ID), 10))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCreateBookIgnoresClientOwner(t *testing.T) {
+	db := testdb.Open(t)
+	router := bookRouter(db)
+	alice := testdb.CreateUser(t, db, "user")
+	bob := testdb.CreateUser(t, db, "user")
+
+	w := doBookRequest(t, router, http.MethodPost, "/books", alice, gin.H{"title": "Dune", "user_id": bob.ID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /books = %d: %s", w.Code, w.Body)
+	}
+	var book models.Book
+	if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil {
+		t.Fatalf("decode book: %v", err)
+	}
+	if book.UserID != alice.ID {
+		t.Errorf("book owned by user %d, want the caller %d", book.UserID, alice.ID)
+	}
+}
+
+func TestBookOwnershipChecks(t *testing.T) {
+	db := testdb.Open(t)
+	router := bookRouter(db)
+	owner := testdb.CreateUser(t, db, "user")
+	stranger := testdb.CreateUser(t, db, "user")
+	librarian := testdb.CreateUser(t, db, "librarian") // books:read and books:update, not books:delete
+	admin := testdb.CreateUser(t, db, "admin")
+
+	book := models.Book{Title: "Dune", UserID: owner.ID}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatalf("create book: %v", err)
+	}
+	path := "/books/" + strconv.FormatUint(uint64(book.ID), 10)
+	update := gin.H{"title": "Dune Messiah"}
+
+	tests := []struct {
+		name   string
+		user   *models.User
+		method string
+		body   interface{}
+		want   int
+	}{
+		{"owner reads", owner, http.MethodGet, nil, http.StatusOK},
+		{"owner updates", owner, http.MethodPut, update, http.StatusOK},
+		// Other users' books do not exist as far as the caller can tell
+		{"stranger reads", stranger, http.MethodGet, nil, http.StatusNotFound},
+		{"stranger updates", stranger, http.MethodPut, update, http.StatusNotFound},
+		{"stranger deletes", stranger, http.MethodDelete, nil, http.StatusNotFound},
+		// Visible but not deletable without books:delete
+		{"librarian reads", librarian, http.MethodGet, nil, http.StatusOK},
+		{"librarian updates", librarian, http.MethodPut, update, http.StatusOK},
+		{"librarian deletes", librarian, http.MethodDelete, nil, http.StatusForbidden},
+		{"admin deletes", admin, http.MethodDelete, nil, http.StatusNoContent},
+		{"owner reads deleted", owner, http.MethodGet, nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := doBookRequest(t, router, tt.method, path, tt.user, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d: %s", tt.name, tt.method, path, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestBookOwnershipUnknownBookMatchesForeignBook(t *testing.T) {
+	db := testdb.Open(t)
+	router := bookRouter(db)
+	stranger := testdb.CreateUser(t, db, "user")
+
+	w := doBookRequest(t, router, http.MethodDelete, "/books/999999999", stranger, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a missing book = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetAllBooksListsOwnBooksOnly(t *testing.T) {
+	db := testdb.Open(t)
+	router := bookRouter(db)
+	alice := testdb.CreateUser(t, db, "user")
+	bob := testdb.CreateUser(t, db, "user")
+	librarian := testdb.CreateUser(t, db, "librarian")
+
+	for _, book := range []models.Book{{Title: "Alice's", UserID: alice.ID}, {Title: "Bob's", UserID: bob.ID}} {
+		if err := db.Create(&book).Error; err != nil {
+			t.Fatalf("create book: %v", err)
+		}
+	}
+
+	var books []models.Book
+	w := doBookRequest(t, router, http.MethodGet, "/books", alice, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatalf("decode books (%d): %v", w.Code, err)
+	}
+	for _, book := range books {
+		if book.UserID != alice.ID {
+			t.Errorf("alice sees book %d of user %d", book.ID, book.UserID)
+		}
+	}
+	if len(books) != 1 {
+		t.Errorf("alice sees %d books, want 1", len(books))
+	}
+
+	w = doBookRequest(t, router, http.MethodGet, "/books", librarian, nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &books); err != nil {
+		t.Fatalf("decode books (%d): %v", w.Code, err)
+	}
+	if len(books) < 2 {
+		t.Errorf("librarian with books:read sees %d books, want every book", len(books))
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/models"
+	"gocheck/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImpersonationController lets admins act as other users for support purposes
+type ImpersonationController struct {
+	impersonationService *services.ImpersonationService
+	auditService         *services.AuditService
+}
+
+// NewImpersonationController creates a new ImpersonationController
+func NewImpersonationController(db *gorm.DB) *ImpersonationController {
+	return &ImpersonationController{
+		impersonationService: services.NewImpersonationService(db),
+		auditService:         services.NewAuditService(db),
+	}
+}
+
+// ImpersonatedUser identifies the user an impersonation token acts as
+type ImpersonatedUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// ImpersonationResponse is returned by POST /admin/impersonate/{id}
+type ImpersonationResponse struct {
+	Token         string           `json:"token"`
+	ExpiresIn     int64            `json:"expires_in"`
+	Impersonating ImpersonatedUser `json:"impersonating"`
+}
+
+// Impersonate godoc
+// @Summary Impersonate a user
+// @Description Issue a short-lived access token for the given user carrying an "act" claim that names the admin. Admins cannot be impersonated, no refresh token is issued and every request made with the token is audited.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/impersonate/{id} [post]
+
+func (ic *ImpersonationController) Impersonate(c *gin.Context) {
+	actorID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	targetID := strconv.FormatUint(id, 10)
+
+	token, target, err := ic.impersonationService.Impersonate(actorID, uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImpersonationForbidden):
+			recordAudit(ic.auditService, newAuditEvent(c, "user.impersonate", "user", targetID, models.AuditOutcomeDenied, err.Error()))
+			c.JSON(http.StatusForbidden, gin.H{"error": "This user cannot be impersonated"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			recordAudit(ic.auditService, newAuditEvent(c, "user.impersonate", "user", targetID, models.AuditOutcomeFailed, err.Error()))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue impersonation token"})
+		}
+		return
+	}
+
+	recordAudit(ic.auditService, newAuditEvent(c, "user.impersonate", "user", targetID, models.AuditOutcomeAllowed, ""))
+	c.JSON(http.StatusOK, ImpersonationResponse{
+		Token:     token,
+		ExpiresIn: int64(services.ImpersonationTTL().Seconds()),
+		Impersonating: ImpersonatedUser{
+			ID:       target.ID,
+			Username: target.Username,
+			Email:    target.Email,
+		},
+	})
+}
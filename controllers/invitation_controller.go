@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/mailer"
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// InvitationController handles sign-up invitations and the acceptance of all invitations
+type InvitationController struct {
+	db                *gorm.DB
+	invitationService *services.InvitationService
+	userService       *services.UserService
+	tokenService      *services.TokenService
+	auditService      *services.AuditService
+}
+
+// NewInvitationController creates a new InvitationController
+func NewInvitationController(db *gorm.DB) *InvitationController {
+	return &InvitationController{
+		db:                db,
+		invitationService: services.NewInvitationService(db, mailer.NewFromConfig()),
+		userService:       services.NewUserService(db),
+		tokenService:      services.NewTokenService(db),
+		auditService:      services.NewAuditService(db),
+	}
+}
+
+// SignupInvitationRequest is the payload accepted by POST /admin/invitations
+type SignupInvitationRequest struct {
+	Email     string     `json:"email" binding:"required,email"`
+	Role      string     `json:"role"`       // Account role of the new user; defaults to "user"
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; defaults to INVITATION_TTL from now
+}
+
+// RegisterWithInvitationRequest is the payload accepted by POST /invitations/:token/accept
+// from someone without an account. The email address comes from the invitation.
+type RegisterWithInvitationRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// CreateSignupInvitation godoc
+// @Summary Invite a new user
+// @Description Email a single-use invitation to register an account with the given role. This is how users join when OPEN_REGISTRATION is off. Inviting with a role other than "user" requires roles:manage. The token is returned once so it can also be passed on by hand.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param request body SignupInvitationRequest true "Invitee email, role and optional expiry"
+// @Success 201 {object} CreatedInvitationResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/invitations [post]
+
+func (ic *InvitationController) CreateSignupInvitation(c *gin.Context) {
+	var req SignupInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = "user"
+	}
+
+	if req.Role != "user" {
+		actor, err := middleware.CurrentActor(c, ic.db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			return
+		}
+		if !actor.Can("roles:manage") {
+			recordAudit(ic.auditService, newAuditEvent(c, "invitation.create", "invitation", "", models.AuditOutcomeDenied, req.Email+" as "+req.Role))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: only role managers can invite users with role " + req.Role})
+			return
+		}
+	}
+
+	inviterID, _ := middleware.RealUserID(c)
+	invitation, token, err := ic.invitationService.CreateSignupInvitation(req.Email, req.Role, inviterID, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		case errors.Is(err, services.ErrInvalidInvitationExpiry):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		}
+		return
+	}
+
+	recordAudit(ic.auditService, newAuditEvent(c, "invitation.create", "invitation", strconv.FormatUint(uint64(invitation.ID), 10), models.AuditOutcomeAllowed, req.Email+" as "+req.Role))
+	c.JSON(http.StatusCreated, CreatedInvitationResponse{Invitation: *invitation, Token: token})
+}
+
+// ListSignupInvitations godoc
+// @Summary List sign-up invitations
+// @Description List invitations to register, newest first, including accepted, revoked and expired ones. Organization invitations are listed per organization.
+// @Tags invitations
+// @Produce json
+// @Success 200 {array} models.Invitation
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/invitations [get]
+
+func (ic *InvitationController) ListSignupInvitations(c *gin.Context) {
+	invitations, err := ic.invitationService.ListInvitations(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeSignupInvitation godoc
+// @Summary Revoke a sign-up invitation
+// @Tags invitations
+// @Param id path int true "Invitation ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/invitations/{id} [delete]
+
+func (ic *InvitationController) RevokeSignupInvitation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := ic.invitationService.RevokeInvitation(nil, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	recordAudit(ic.auditService, newAuditEvent(c, "invitation.revoke", "invitation", c.Param("id"), models.AuditOutcomeAllowed, ""))
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Description Without credentials, register a new account with the invited email address: send a username and password. The account's email counts as verified and, for an organization invitation, the new user joins the organization. Signed-in users accept organization invitations sent to their own email address without a body; use POST /orgs/{id}/switch afterwards to work in the organization.
+// @Tags invitations
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param request body RegisterWithInvitationRequest false "Username and password of the new account"
+// @Success 200 {object} models.OrganizationMembership
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /invitations/{token}/accept [post]
+
+func (ic *InvitationController) AcceptInvitation(c *gin.Context) {
+	if _, authenticated := c.Get("userID"); authenticated {
+		ic.joinOrganization(c)
+		return
+	}
+
+	var req RegisterWithInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := models.User{Username: req.Username, Password: req.Password}
+	membership, err := ic.invitationService.WithActor(auditActor(c)).RegisterWithInvitation(c.Param("token"), &user)
+	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrInvalidInvitation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		case errors.Is(err, services.ErrInvitationEmailRegistered):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email address already exists; sign in to accept the invitation"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		}
+		return
+	}
+
+	grant := services.TokenGrant{}
+	if membership != nil {
+		grant.OrgID = membership.OrganizationID
+	}
+	tokens, err := ic.tokenService.StartSession(&user, grant, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User created successfully",
+		"user": gin.H{
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"role":           user.Role,
+			"email_verified": user.EmailVerified,
+		},
+		"membership":    membership,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// joinOrganization accepts an organization invitation for the signed-in user
+func (ic *InvitationController) joinOrganization(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := ic.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	membership, err := ic.invitationService.AcceptInvitation(c.Param("token"), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidInvitation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		case errors.Is(err, services.ErrInvitationEmailMismatch):
+			c.JSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to a different email address"})
+		case errors.Is(err, services.ErrInvitationNeedsRegistration):
+			c.JSON(http.StatusConflict, gin.H{"error": "This invitation is for creating a new account; accept it without signing in"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		}
+		return
+	}
+
+	recordAudit(ic.auditService, newAuditEvent(c, "organization.accept_invitation", "organization", strconv.FormatUint(uint64(membership.OrganizationID), 10), models.AuditOutcomeAllowed, "as "+membership.Role))
+	c.JSON(http.StatusOK, membership)
+}
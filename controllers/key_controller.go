@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"gocheck/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyController publishes the public keys used to verify issued tokens
+type KeyController struct{}
+
+// NewKeyController creates a new KeyController
+func NewKeyController() *KeyController {
+	return &KeyController{}
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys (active and recently rotated) that verify tokens issued by this API. Empty when tokens are HMAC-signed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Router /.well-known/jwks.json [get]
+
+func (kc *KeyController) JWKS(c *gin.Context) {
+	// Allow verifiers to cache the set, but pick up rotations reasonably quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.PublicJWKS())
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"gocheck/config"
+	"gocheck/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJWKSPublishesActiveKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.JWTAlgorithm = "EdDSA"
+	config.AppConfig.JWTPrivateKeyFile = keyFile
+	config.AppConfig.JWTKeyID = "2026-10"
+	config.AppConfig.JWTRetiredKeys = nil
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatalf("LoadSigningKeys: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", NewKeyController().JWKS)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /.well-known/jwks.json = %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc == "" {
+		t.Error("JWKS response is not cacheable")
+	}
+
+	var set utils.JWKSet
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatalf("decode JWKS: %v", err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kid != "2026-10" || set.Keys[0].Kty != "OKP" {
+		t.Errorf("JWKS = %+v, want the active Ed25519 key", set)
+	}
+}
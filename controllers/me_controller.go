@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/mailer"
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MeController serves the /me endpoints, which act on the authenticated user
+// without the client having to know its own user ID
+type MeController struct {
+	userService         *services.UserService
+	bookService         *services.BookService
+	verificationService *services.VerificationService
+}
+
+// NewMeController creates a new MeController
+func NewMeController(db *gorm.DB) *MeController {
+	return &MeController{
+		userService:         services.NewUserService(db),
+		bookService:         services.NewBookService(db),
+		verificationService: services.NewVerificationService(db, mailer.NewFromConfig()),
+	}
+}
+
+// ProfileResponse is the current user's own view of their account. It leaves
+// out credentials and internal bookkeeping.
+type ProfileResponse struct {
+	ID             uint         `json:"id"`
+	Username       string       `json:"username"`
+	Email          string       `json:"email"`
+	EmailVerified  bool         `json:"email_verified"`
+	Name           *models.Name `json:"name"`
+	Role           string       `json:"role"`
+	TOTPEnabled    bool         `json:"totp_enabled"`
+	Status         string       `json:"status"`
+	OrganizationID uint         `json:"organization_id,omitempty"`   // Organization the current token works in
+	OrgRole        string       `json:"organization_role,omitempty"` // Role in that organization
+}
+
+// UpdateProfileRequest is the payload accepted by PATCH /me. Omitted fields are
+// left unchanged; the role cannot be changed here.
+type UpdateProfileRequest struct {
+	Name     *models.Name `json:"name"`
+	Username *string      `json:"username" binding:"omitempty,min=1"`
+	Email    *string      `json:"email" binding:"omitempty,email"`
+}
+
+// DeleteProfileRequest is the payload accepted by DELETE /me
+type DeleteProfileRequest struct {
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// GetProfile godoc
+// @Summary Get my profile
+// @Description Return the authenticated user's profile
+// @Tags me
+// @Produce json
+// @Success 200 {object} ProfileResponse
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me [get]
+
+func (mc *MeController) GetProfile(c *gin.Context) {
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newProfileResponse(c, user))
+}
+
+// UpdateProfile godoc
+// @Summary Update my profile
+// @Description Change the authenticated user's name, username or email. A new email address has to be verified again; a verification link is sent to it.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param request body UpdateProfileRequest true "Fields to change"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me [patch]
+
+func (mc *MeController) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := mc.currentUser(c)
+	if !ok {
+		return
+	}
+
+	changes := models.User{ID: user.ID, Name: user.Name, Username: user.Username, Email: user.Email}
+	if changes.Name == nil {
+		changes.Name = &models.Name{}
+	}
+	if req.Name != nil {
+		changes.Name = req.Name
+	}
+	if req.Username != nil {
+		changes.Username = *req.Username
+	}
+	if req.Email != nil {
+		changes.Email = *req.Email
+	}
+
+	updatedUser, err := mc.userService.WithActor(auditActor(c)).UpdateUser(&changes)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if updatedUser.Email != user.Email {
+		// The profile is saved either way; a failed email can be retried via the resend endpoint
+		if err := mc.verificationService.SendVerification(updatedUser); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", updatedUser.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, newProfileResponse(c, updatedUser))
+}
+
+// DeleteProfile godoc
+// @Summary Delete my account
+// @Description Permanently delete the authenticated user's account and books after confirming the password. Refused while the user is the only owner of an organization with other members.
+// @Tags me
+// @Accept json
+// @Param request body DeleteProfileRequest true "Current password"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me [delete]
+
+func (mc *MeController) DeleteProfile(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	var req DeleteProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := mc.userService.WithActor(auditActor(c)).DeleteAccount(userID, req.Password); err != nil {
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrLastOwner):
+			c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership of your organizations before deleting your account"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// GetMyBooks godoc
+// @Summary List my books
+// @Description Return the books owned by the authenticated user in the current organization
+// @Tags me
+// @Produce json
+// @Success 200 {array} models.Book
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me/books [get]
+
+func (mc *MeController) GetMyBooks(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	books, err := mc.bookService.WithTenant(middleware.OrganizationID(c)).GetBooksByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		return
+	}
+	c.JSON(http.StatusOK, books)
+}
+
+// currentUser loads the authenticated user, writing the error response when it cannot
+func (mc *MeController) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	user, err := mc.userService.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// newProfileResponse builds the profile of user as seen from the current request
+func newProfileResponse(c *gin.Context, user *models.User) ProfileResponse {
+	return ProfileResponse{
+		ID:             user.ID,
+		Username:       user.Username,
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerified,
+		Name:           user.Name,
+		Role:           user.Role,
+		TOTPEnabled:    user.TOTPEnabled,
+		Status:         user.Status,
+		OrganizationID: middleware.OrganizationID(c),
+		OrgRole:        middleware.OrganizationRole(c),
+	}
+}
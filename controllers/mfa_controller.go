@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/middleware"
+	"gocheck/services"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MFAController handles TOTP enrollment and the second step of login
+type MFAController struct {
+	mfaService     *services.MFAService
+	tokenService   *services.TokenService
+	loginThrottler *services.LoginThrottler
+}
+
+// NewMFAController creates a new MFAController
+func NewMFAController(db *gorm.DB) *MFAController {
+	return &MFAController{
+		mfaService:     services.NewMFAService(db),
+		tokenService:   services.NewTokenService(db),
+		loginThrottler: loginThrottler,
+	}
+}
+
+// MFACodeRequest carries a TOTP or recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginRequest is the payload accepted by POST /login/mfa
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP code or recovery code
+}
+
+// Enroll godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret and otpauth:// URI for the current user. Enrollment completes once a code is confirmed.
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} services.TOTPEnrollment
+// @Failure 401 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /mfa/totp/enroll [post]
+
+func (mc *MFAController) Enroll(c *gin.Context) {
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	enrollment, err := mc.mfaService.BeginEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enable TOTP with a code from the authenticator app. Returns recovery codes, which are only shown once.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body MFACodeRequest true "TOTP code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /mfa/totp/confirm [post]
+
+func (mc *MFAController) Confirm(c *gin.Context) {
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := mc.mfaService.ConfirmEnrollment(userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMFAAlreadyEnabled):
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		case errors.Is(err, services.ErrMFANotEnrolled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment before confirming"})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm enrollment"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Log in again to obtain a two-factor session",
+		"recovery_codes": codes,
+	})
+}
+
+// Disable godoc
+// @Summary Disable TOTP
+// @Description Turn off two-factor authentication using a current TOTP or recovery code. Not allowed for roles that require it.
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /mfa/totp [delete]
+
+func (mc *MFAController) Disable(c *gin.Context) {
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := mc.mfaService.Disable(userID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrMFANotEnrolled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		case errors.Is(err, services.ErrMFARequiredForRole):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for your role or permissions"})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA godoc
+// @Summary Complete two-factor login
+// @Description Exchange the mfa_token returned by /login plus a TOTP or recovery code for access and refresh tokens. The mfa_token works once and is invalidated after MFA_MAX_ATTEMPTS wrong codes; repeated failures lock the user's second step like failed passwords do.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MFALoginRequest true "Pending token and code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 429 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /login/mfa [post]
+
+func (mc *MFAController) LoginMFA(c *gin.Context) {
+	var req MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pending, err := mc.mfaService.PendingLogin(req.MFAToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	if wait, err := mc.loginThrottler.CheckMFA(pending.UserID, c.ClientIP()); err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Please try again later"})
+		return
+	}
+
+	user, scopes, err := mc.mfaService.CompleteLogin(pending, req.Code)
+	if err != nil {
+		if middleware.RespondAccountStatus(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrMFANotEnrolled) {
+			failures := mc.loginThrottler.RecordMFAFailure(pending.UserID, pending.ID, c.ClientIP())
+			if failures >= services.MaxPendingLoginAttempts() {
+				// Make the client start over with the password
+				if err := mc.mfaService.InvalidatePendingLogin(pending); err != nil {
+					log.Printf("Failed to invalidate MFA pending token of user %d: %v", pending.UserID, err)
+				}
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	mc.loginThrottler.RecordMFASuccess(pending.UserID, pending.ID)
+
+	tokens, err := mc.tokenService.StartSession(user, services.TokenGrant{MFA: true, Scopes: scopes}, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user": gin.H{
+			"ID":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+		},
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
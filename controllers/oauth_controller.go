@@ -0,0 +1,518 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/services"
+	"gocheck/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OAuthController exposes the OAuth2 authorization server
+type OAuthController struct {
+	oauthService *services.OAuthService
+}
+
+// NewOAuthController creates a new OAuthController
+func NewOAuthController(db *gorm.DB) *OAuthController {
+	return &OAuthController{
+		oauthService: services.NewOAuthService(db),
+	}
+}
+
+// RegisterClientRequest is the payload accepted by POST /oauth/clients
+type RegisterClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris"` // Required for the authorization_code grant
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Confidential *bool    `json:"confidential"` // Defaults to true; public clients get no secret
+}
+
+// OAuthClientResponse describes a registered client without its secret
+type OAuthClientResponse struct {
+	ID           uint       `json:"id"`
+	ClientID     string     `json:"client_id"`
+	Name         string     `json:"name"`
+	RedirectURIs []string   `json:"redirect_uris"`
+	Scopes       []string   `json:"scopes"`
+	Confidential bool       `json:"confidential"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RegisteredClientResponse is returned once, when a client is registered
+type RegisteredClientResponse struct {
+	OAuthClientResponse
+	ClientSecret string `json:"client_secret,omitempty"` // Only for confidential clients; it cannot be retrieved again
+}
+
+// ConsentRequest is the payload accepted by POST /oauth/authorize
+type ConsentRequest struct {
+	ResponseType        string `json:"response_type" binding:"required"`
+	ClientID            string `json:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" binding:"required"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+// RegisterClient godoc
+// @Summary Register an OAuth2 client
+// @Description Register a third-party application owned by the current user. Confidential clients receive a secret that is only shown in this response.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param request body RegisterClientRequest true "Client details"
+// @Success 201 {object} RegisteredClientResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/clients [post]
+
+func (oc *OAuthController) RegisterClient(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	var req RegisterClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	confidential := req.Confidential == nil || *req.Confidential
+	if !confidential && len(req.RedirectURIs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Public clients need at least one redirect URI"})
+		return
+	}
+
+	client, secret, err := oc.oauthService.RegisterClient(userID, req.Name, req.RedirectURIs, req.Scopes, confidential)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOAuthInvalidRedirectURI):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Redirect URIs must be absolute and must not contain a fragment"})
+		case errors.Is(err, utils.ErrUnknownScope):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "known_scopes": utils.KnownScopes})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register client"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, RegisteredClientResponse{OAuthClientResponse: toOAuthClientResponse(client), ClientSecret: secret})
+}
+
+// ListClients godoc
+// @Summary List OAuth2 clients
+// @Description List the OAuth2 clients registered by the current user
+// @Tags oauth
+// @Produce json
+// @Success 200 {array} OAuthClientResponse
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/clients [get]
+
+func (oc *OAuthController) ListClients(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	clients, err := oc.oauthService.ListClients(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clients"})
+		return
+	}
+
+	response := make([]OAuthClientResponse, len(clients))
+	for i := range clients {
+		response[i] = toOAuthClientResponse(&clients[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeClient godoc
+// @Summary Revoke an OAuth2 client
+// @Description Disable a client and invalidate every token issued to it
+// @Tags oauth
+// @Param id path int true "Client record ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/clients/{id} [delete]
+
+func (oc *OAuthController) RevokeClient(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return
+	}
+
+	if err := oc.oauthService.RevokeClient(userID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke client"})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Authorize godoc
+// @Summary Start an OAuth2 authorization
+// @Description Validate an authorization request (response_type=code with S256 PKCE) and describe the consent the user is asked for. The decision is submitted with POST /oauth/authorize.
+// @Tags oauth
+// @Produce json
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes; defaults to all scopes of the client"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Router /oauth/authorize [get]
+
+func (oc *OAuthController) Authorize(c *gin.Context) {
+	if _, ok := firstPartyUserID(c); !ok {
+		return
+	}
+
+	req := services.AuthorizeRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+	client, scopes, ok := oc.validateAuthorize(c, req)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": gin.H{
+			"client_id": client.ClientID,
+			"name":      client.Name,
+		},
+		"scopes":       scopes,
+		"redirect_uri": req.RedirectURI,
+		"state":        req.State,
+	})
+}
+
+// Consent godoc
+// @Summary Approve or deny an OAuth2 authorization
+// @Description Record the user's decision. The response names the URL to send the browser to, carrying either an authorization code or an access_denied error.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param request body ConsentRequest true "Authorization request and decision"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/authorize [post]
+
+func (oc *OAuthController) Consent(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	var body ConsentRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req := services.AuthorizeRequest{
+		ResponseType:        body.ResponseType,
+		ClientID:            body.ClientID,
+		RedirectURI:         body.RedirectURI,
+		Scope:               body.Scope,
+		State:               body.State,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+	}
+	client, scopes, ok := oc.validateAuthorize(c, req)
+	if !ok {
+		return
+	}
+
+	if !body.Approve {
+		c.JSON(http.StatusOK, gin.H{"redirect_to": redirectURL(req.RedirectURI, url.Values{"error": {"access_denied"}}, req.State)})
+		return
+	}
+
+	code, err := oc.oauthService.IssueAuthorizationCode(client, userID, req, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue authorization code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redirect_to": redirectURL(req.RedirectURI, url.Values{"code": {code}}, req.State)})
+}
+
+// Token godoc
+// @Summary OAuth2 token endpoint
+// @Description Issue tokens for the authorization_code (with PKCE), refresh_token and client_credentials grants. Clients authenticate with HTTP Basic or client_id/client_secret form fields.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI used in the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Requested scopes; for refresh_token, a subset of the original grant"
+// @Success 200 {object} services.OAuthTokenResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/token [post]
+
+func (oc *OAuthController) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, ok := oc.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	var response *services.OAuthTokenResponse
+	var err error
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		response, err = oc.oauthService.ExchangeAuthorizationCode(client, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	case "refresh_token":
+		response, err = oc.oauthService.RefreshToken(client, c.PostForm("refresh_token"), c.PostForm("scope"))
+	case "client_credentials":
+		response, err = oc.oauthService.ClientCredentials(client, c.PostForm("scope"))
+	case "":
+		err = services.ErrOAuthInvalidRequest
+	default:
+		err = services.ErrOAuthUnsupportedGrantType
+	}
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect godoc
+// @Summary Introspect a token
+// @Description RFC 7662 token introspection for confidential clients
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} services.Introspection
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/introspect [post]
+
+func (oc *OAuthController) Introspect(c *gin.Context) {
+	client, ok := oc.authenticateClient(c)
+	if !ok {
+		return
+	}
+	if !client.Confidential {
+		respondOAuthError(c, services.ErrOAuthUnauthorizedClient)
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		respondOAuthError(c, services.ErrOAuthInvalidRequest)
+		return
+	}
+
+	result, err := oc.oauthService.Introspect(token, c.PostForm("token_type_hint"))
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Revoke godoc
+// @Summary Revoke a token
+// @Description RFC 7009 token revocation. Revoking a refresh token revokes its whole family. Unknown tokens are accepted silently.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 "OK"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /oauth/revoke [post]
+
+func (oc *OAuthController) Revoke(c *gin.Context) {
+	client, ok := oc.authenticateClient(c)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		respondOAuthError(c, services.ErrOAuthInvalidRequest)
+		return
+	}
+
+	if err := oc.oauthService.Revoke(client, token, c.PostForm("token_type_hint")); err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// validateAuthorize checks an authorization request and writes the error response
+// itself when it is invalid. Problems with the client or redirect URI are reported
+// to the user; others are described as a redirect back to the client.
+func (oc *OAuthController) validateAuthorize(c *gin.Context, req services.AuthorizeRequest) (*models.OAuthClient, []string, bool) {
+	client, scopes, err := oc.oauthService.ValidateAuthorizeRequest(req)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthInvalidRedirectURI) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown client or unregistered redirect_uri"})
+			return nil, nil, false
+		}
+		if errors.Is(err, services.ErrOAuthInvalidRequest) || errors.Is(err, services.ErrOAuthInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       err.Error(),
+				"redirect_to": redirectURL(req.RedirectURI, url.Values{"error": {err.Error()}}, req.State),
+			})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate authorization request"})
+		return nil, nil, false
+	}
+
+	// A scoped session cannot authorize a client beyond its own scopes
+	if granted, limited := middleware.Scopes(c); limited && !utils.ScopesAllowed(scopes, granted) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Requested scopes exceed those of the current token"})
+		return nil, nil, false
+	}
+	return client, scopes, true
+}
+
+// authenticateClient reads client credentials from HTTP Basic auth or the form
+// body and writes an invalid_client response when they are wrong
+func (oc *OAuthController) authenticateClient(c *gin.Context) (*models.OAuthClient, bool) {
+	clientID, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	client, err := oc.oauthService.AuthenticateClient(clientID, secret)
+	if err != nil {
+		respondOAuthError(c, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// firstPartyUserID returns the caller's user ID, refusing API keys and tokens
+// issued to OAuth2 clients: only the user themselves may register clients or
+// grant consent. It writes the error response itself.
+func firstPartyUserID(c *gin.Context) (uint, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+	if _, viaAPIKey := c.Get("apiKeyID"); viaAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an API key"})
+		return 0, false
+	}
+	claimsAny, _ := c.Get("claims")
+	if claims, ok := claimsAny.(*utils.Claims); ok && claims.ClientID != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with a token issued to an OAuth2 client"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// respondOAuthError writes an RFC 6749 error response
+func respondOAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOAuthInvalidClient):
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client", "error_description": "Client authentication failed"})
+	case errors.Is(err, services.ErrOAuthInvalidRequest),
+		errors.Is(err, services.ErrOAuthInvalidGrant),
+		errors.Is(err, services.ErrOAuthUnauthorizedClient),
+		errors.Is(err, services.ErrOAuthUnsupportedGrantType),
+		errors.Is(err, services.ErrOAuthInvalidScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("OAuth2 request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+	}
+}
+
+// redirectURL appends parameters and the state to a client's redirect URI
+func redirectURL(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, v := range values {
+			query.Add(key, v)
+		}
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// toOAuthClientResponse converts a client record into its public representation
+func toOAuthClientResponse(client *models.OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:           client.ID,
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIList(),
+		Scopes:       client.ScopeList(),
+		Confidential: client.Confidential,
+		RevokedAt:    client.RevokedAt,
+		CreatedAt:    client.CreatedAt,
+	}
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/config"
+	"gocheck/oidc"
+	"gocheck/services"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcStateCookie holds the signed state of a login between redirect and callback
+const oidcStateCookie = "oidc_login"
+
+// OIDCController handles sign-in through an external OpenID Connect provider
+type OIDCController struct {
+	oidcService  *services.OIDCService
+	mfaService   *services.MFAService
+	tokenService *services.TokenService
+}
+
+// NewOIDCController creates a new OIDCController
+func NewOIDCController(db *gorm.DB) *OIDCController {
+	return &OIDCController{
+		oidcService:  services.NewOIDCService(db),
+		mfaService:   services.NewMFAService(db),
+		tokenService: services.NewTokenService(db),
+	}
+}
+
+// Login godoc
+// @Summary Sign in with the identity provider
+// @Description Redirect the browser to the configured OpenID Connect provider
+// @Tags auth
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} gin.H
+// @Failure 502 {object} gin.H
+// @Router /auth/oidc/login [get]
+
+func (oc *OIDCController) Login(c *gin.Context) {
+	authURL, stateToken, err := oc.oidcService.BeginLogin(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OpenID Connect login is not configured"})
+			return
+		}
+		log.Printf("Failed to start OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	oc.setStateCookie(c, stateToken, int(services.OIDCLoginTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary Identity provider callback
+// @Description Complete an OpenID Connect login. Unknown identities are provisioned (only with a pending sign-up invitation while OPEN_REGISTRATION is off), or linked to an existing account whose email the provider verified. Accounts with TOTP receive an mfa_token for /login/mfa.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 502 {object} gin.H
+// @Router /auth/oidc/callback [get]
+
+func (oc *OIDCController) Callback(c *gin.Context) {
+	stateToken, _ := c.Cookie(oidcStateCookie)
+	oc.setStateCookie(c, "", -1) // The state is single-use
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider denied the login", "provider_error": providerErr})
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization code is required"})
+		return
+	}
+
+	user, err := oc.oidcService.CompleteLogin(c.Request.Context(), stateToken, c.Query("state"), code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOIDCDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": "OpenID Connect login is not configured"})
+		case errors.Is(err, services.ErrOIDCInvalidState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Login session expired or was started in another browser. Please try again"})
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			log.Printf("Rejected OIDC ID token: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider response could not be verified"})
+		case errors.Is(err, services.ErrOIDCAccountExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Log in with your password instead"})
+		case errors.Is(err, services.ErrOIDCNotProvisioned):
+			c.JSON(http.StatusForbidden, gin.H{"error": "No account is linked to this identity"})
+		case errors.Is(err, services.ErrOIDCInvitationRequired):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is by invitation only"})
+		case errors.Is(err, services.ErrAccountSuspended):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is suspended"})
+		case errors.Is(err, services.ErrAccountDeactivated):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		case errors.Is(err, services.ErrOIDCEmailRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Identity provider did not share an email address"})
+		default:
+			log.Printf("OIDC login failed: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to complete login with the identity provider"})
+		}
+		return
+	}
+
+	// The provider replaces the password step only; TOTP still applies
+	if user.TOTPEnabled {
+		mfaToken, err := oc.mfaService.IssuePendingToken(user, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	tokens, err := oc.tokenService.StartSession(user, services.TokenGrant{}, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	response := gin.H{
+		"message": "Login successful",
+		"user": gin.H{
+			"ID":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+		},
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	}
+	if required, err := oc.mfaService.RequiresMFA(user); err != nil {
+		log.Printf("Failed to check two-factor requirement for user %d: %v", user.ID, err)
+	} else if required {
+		response["mfa_enrollment_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setStateCookie writes (or, with maxAge -1, clears) the login state cookie. It is
+// SameSite=Lax so it survives the top-level redirect back from the provider.
+func (oc *OIDCController) setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(config.AppConfig.BaseURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/auth/oidc", "", secure, true)
+}
@@ -0,0 +1,637 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/mailer"
+	"gocheck/middleware"
+	"gocheck/models"
+	"gocheck/policy"
+	"gocheck/services"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// validSlug accepts lowercase words separated by single dashes, e.g. "physics-dept"
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// OrganizationController handles organizations, memberships and invitations
+type OrganizationController struct {
+	db                *gorm.DB
+	orgPolicy         policy.Authorizer
+	orgService        *services.OrganizationService
+	invitationService *services.InvitationService
+	tokenService      *services.TokenService
+	userService       *services.UserService
+	auditService      *services.AuditService
+}
+
+// NewOrganizationController creates a new OrganizationController
+func NewOrganizationController(db *gorm.DB) *OrganizationController {
+	return &OrganizationController{
+		db:                db,
+		orgPolicy:         policy.OrganizationPolicy{},
+		orgService:        services.NewOrganizationService(db),
+		invitationService: services.NewInvitationService(db, mailer.NewFromConfig()),
+		tokenService:      services.NewTokenService(db),
+		userService:       services.NewUserService(db),
+		auditService:      services.NewAuditService(db),
+	}
+}
+
+// OrganizationRequest is the payload accepted when creating or updating an organization
+type OrganizationRequest struct {
+	Name    string `json:"name" binding:"required,max=100"`
+	Slug    string `json:"slug" binding:"required,max=50"`
+	OwnerID uint   `json:"owner_id"` // Optional on creation: user who becomes the first owner
+}
+
+// MemberRoleRequest is the payload accepted by PUT /admin/organizations/:id/members/:userId
+type MemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// InvitationRequest is the payload accepted by POST /admin/organizations/:id/invitations
+type InvitationRequest struct {
+	Email     string     `json:"email" binding:"required,email"`
+	Role      string     `json:"role" binding:"required,oneof=owner admin member"`
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; defaults to INVITATION_TTL from now
+}
+
+// CreatedInvitationResponse is returned once, when an invitation is created
+type CreatedInvitationResponse struct {
+	models.Invitation
+	Token string `json:"token"` // Also emailed to the invitee; it cannot be retrieved again
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description Create a tenant. Books created while working in an organization are only visible within it. Requires orgs:manage.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param request body OrganizationRequest true "Name, slug and optional first owner"
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations [post]
+
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validSlug.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug may only contain lowercase letters, digits and single dashes"})
+		return
+	}
+
+	org, err := oc.orgService.CreateOrganization(req.Name, req.Slug, req.OwnerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrganizationSlugTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug is already in use"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Owner not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		}
+		return
+	}
+
+	oc.audit(c, "organization.create", org.ID, org.Slug)
+	c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations godoc
+// @Summary List organizations
+// @Tags organizations
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations [get]
+
+func (oc *OrganizationController) ListOrganizations(c *gin.Context) {
+	orgs, err := oc.orgService.ListOrganizations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// GetOrganization godoc
+// @Summary Get an organization
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/organizations/{id} [get]
+
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	org, ok := oc.loadOrganization(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateOrganization godoc
+// @Summary Rename an organization
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param request body OrganizationRequest true "New name and slug"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id} [put]
+
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validSlug.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug may only contain lowercase letters, digits and single dashes"})
+		return
+	}
+
+	org, err := oc.orgService.UpdateOrganization(uint(id), req.Name, req.Slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		case errors.Is(err, services.ErrOrganizationSlugTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug is already in use"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		}
+		return
+	}
+
+	oc.audit(c, "organization.update", org.ID, org.Slug)
+	c.JSON(http.StatusOK, org)
+}
+
+// DeleteOrganization godoc
+// @Summary Delete an organization
+// @Description Delete an organization that has no members and no books left. Pending invitations are deleted with it.
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id} [delete]
+
+func (oc *OrganizationController) DeleteOrganization(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	if err := oc.orgService.DeleteOrganization(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		case errors.Is(err, services.ErrOrganizationNotEmpty):
+			c.JSON(http.StatusConflict, gin.H{"error": "Remove all members and books before deleting the organization"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete organization"})
+		}
+		return
+	}
+
+	oc.audit(c, "organization.delete", uint(id), "")
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListMembers godoc
+// @Summary List organization members
+// @Description Available to holders of orgs:manage and to owners and admins of the organization.
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {array} services.OrganizationMember
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/members [get]
+
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+
+	members, err := oc.orgService.ListMembers(org.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// SetMemberRole godoc
+// @Summary Add a member or change their role
+// @Description Change a member's per-organization role. Only owners (or holders of orgs:manage) may grant or revoke ownership. Only holders of orgs:manage may add users who are not members yet; organization owners and admins invite them instead.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param userId path int true "User ID"
+// @Param request body MemberRoleRequest true "Role: owner, admin or member"
+// @Success 200 {object} models.OrganizationMembership
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/members/{userId} [put]
+
+func (oc *OrganizationController) SetMemberRole(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := oc.orgService.Membership(org.ID, uint(userID))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch membership"})
+		return
+	}
+	touchesOwner := req.Role == models.OrgRoleOwner || (current != nil && current.Role == models.OrgRoleOwner)
+	if touchesOwner && !oc.authorize(c, org, policy.ActionGrantOwnership) {
+		return
+	}
+
+	actor, err := middleware.CurrentActor(c, oc.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+	canAdd := oc.orgPolicy.Authorize(actor, policy.ActionAddMembers, org) == nil
+
+	membership, err := oc.orgService.SetMemberRole(org.ID, uint(userID), req.Role, canAdd)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNotMember):
+			recordAudit(oc.auditService, newAuditEvent(c, policy.ActionAddMembers, "organization", strconv.FormatUint(uint64(org.ID), 10), models.AuditOutcomeDenied, "user "+strconv.FormatUint(userID, 10)))
+			c.JSON(http.StatusForbidden, gin.H{"error": "User is not a member of this organization; send them an invitation instead"})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrLastOwner):
+			c.JSON(http.StatusConflict, gin.H{"error": "The organization must keep at least one owner"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update membership"})
+		}
+		return
+	}
+
+	oc.audit(c, "organization.set_member_role", org.ID, "user "+strconv.FormatUint(userID, 10)+" -> "+req.Role)
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveMember godoc
+// @Summary Remove a member
+// @Description Remove a user from the organization. Books they created stay with the organization.
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Param userId path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/members/{userId} [delete]
+
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	current, err := oc.orgService.Membership(org.ID, uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Membership not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch membership"})
+		return
+	}
+	if current.Role == models.OrgRoleOwner && !oc.authorize(c, org, policy.ActionGrantOwnership) {
+		return
+	}
+
+	if err := oc.orgService.RemoveMember(org.ID, uint(userID)); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Membership not found"})
+		case errors.Is(err, services.ErrLastOwner):
+			c.JSON(http.StatusConflict, gin.H{"error": "The organization must keep at least one owner"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		}
+		return
+	}
+
+	oc.audit(c, "organization.remove_member", org.ID, "user "+strconv.FormatUint(userID, 10))
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// CreateInvitation godoc
+// @Summary Invite someone to an organization
+// @Description Email a single-use invitation to join the organization with the given role. Invitees without an account register with it. The token is returned once so it can also be passed on by hand.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param request body InvitationRequest true "Invitee email and role"
+// @Success 201 {object} CreatedInvitationResponse
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/invitations [post]
+
+func (oc *OrganizationController) CreateInvitation(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == models.OrgRoleOwner && !oc.authorize(c, org, policy.ActionGrantOwnership) {
+		return
+	}
+
+	inviterID, _ := middleware.RealUserID(c)
+	invitation, token, err := oc.invitationService.CreateInvitation(org.ID, req.Email, req.Role, inviterID, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidInvitationExpiry) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	oc.audit(c, "organization.invite", org.ID, req.Email+" as "+req.Role)
+	c.JSON(http.StatusCreated, CreatedInvitationResponse{Invitation: *invitation, Token: token})
+}
+
+// ListInvitations godoc
+// @Summary List an organization's invitations
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.Invitation
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/invitations [get]
+
+func (oc *OrganizationController) ListInvitations(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+
+	invitations, err := oc.invitationService.ListInvitations(&org.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Tags organizations
+// @Param id path int true "Organization ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/organizations/{id}/invitations/{invitationId} [delete]
+
+func (oc *OrganizationController) RevokeInvitation(c *gin.Context) {
+	org, ok := oc.authorizedOrganization(c, policy.ActionManageMembers)
+	if !ok {
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := oc.invitationService.RevokeInvitation(&org.ID, uint(invitationID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending invitation not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	oc.audit(c, "organization.revoke_invitation", org.ID, "invitation "+strconv.FormatUint(invitationID, 10))
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListMyOrganizations godoc
+// @Summary List my organizations
+// @Description List the organizations the current user belongs to and their role in each. The "org" claim of the current token names the active one.
+// @Tags organizations
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /orgs [get]
+
+func (oc *OrganizationController) ListMyOrganizations(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	memberships, err := oc.orgService.ListMemberships(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active_org_id": middleware.OrganizationID(c),
+		"memberships":   memberships,
+	})
+}
+
+// SwitchOrganization godoc
+// @Summary Switch organization
+// @Description Issue a new token pair confined to another organization the user belongs to. Second-factor status and scopes of the current session carry over.
+// @Tags organizations
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} services.TokenPair
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /orgs/{id}/switch [post]
+
+func (oc *OrganizationController) SwitchOrganization(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+	orgID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return
+	}
+
+	if _, err := oc.orgService.Membership(uint(orgID), userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this organization"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch membership"})
+		return
+	}
+
+	user, err := oc.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	// The new pair continues the current login session on this device
+	grant := services.TokenGrant{OrgID: uint(orgID), SessionID: currentSessionID(c)}
+	mfa, _ := c.Get("mfa")
+	grant.MFA, _ = mfa.(bool)
+	grant.Scopes, _ = middleware.Scopes(c)
+	tokens, err := oc.tokenService.IssueTokenPair(user, grant)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// loadOrganization loads the organization named in the URL, writing the error response when it cannot
+func (oc *OrganizationController) loadOrganization(c *gin.Context) (*models.Organization, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		return nil, false
+	}
+	org, err := oc.orgService.GetOrganization(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization"})
+		return nil, false
+	}
+	return org, true
+}
+
+// authorizedOrganization loads the organization named in the URL and checks the
+// caller may perform action on it, writing the error response when not
+func (oc *OrganizationController) authorizedOrganization(c *gin.Context, action string) (*models.Organization, bool) {
+	org, ok := oc.loadOrganization(c)
+	if !ok {
+		return nil, false
+	}
+	if !oc.authorize(c, org, action) {
+		return nil, false
+	}
+	return org, true
+}
+
+// authorize checks the organization policy, writing a 403 and auditing the denial when it fails
+func (oc *OrganizationController) authorize(c *gin.Context, org *models.Organization, action string) bool {
+	actor, err := middleware.CurrentActor(c, oc.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return false
+	}
+	if err := oc.orgPolicy.Authorize(actor, action, org); err != nil {
+		recordAudit(oc.auditService, newAuditEvent(c, action, "organization", strconv.FormatUint(uint64(org.ID), 10), models.AuditOutcomeDenied, ""))
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: you may not manage this organization"})
+		return false
+	}
+	return true
+}
+
+// audit records a successful change to an organization
+func (oc *OrganizationController) audit(c *gin.Context, action string, orgID uint, detail string) {
+	recordAudit(oc.auditService, newAuditEvent(c, action, "organization", strconv.FormatUint(uint64(orgID), 10), models.AuditOutcomeAllowed, detail))
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/mailer"
+	"gocheck/services"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PasswordController handles password recovery requests
+type PasswordController struct {
+	passwordService *services.PasswordService
+}
+
+// NewPasswordController creates a new PasswordController
+func NewPasswordController(db *gorm.DB) *PasswordController {
+	return &PasswordController{
+		passwordService: services.NewPasswordService(db, mailer.NewFromConfig()),
+	}
+}
+
+// ForgotPasswordRequest is the payload accepted by POST /password/forgot
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest is the payload accepted by POST /password/reset
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,max=72"`
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset token, or a link to PASSWORD_RESET_URL carrying it. The response is the same whether or not the address is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Account email"
+// @Success 202 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /password/forgot [post]
+
+func (pc *PasswordController) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token is issued and mailed after responding, and failures are only
+	// logged, so neither the response nor its timing reveals whether the account exists
+	go func(email string) {
+		if err := pc.passwordService.RequestReset(email); err != nil {
+			log.Printf("Password reset request failed: %v", err)
+		}
+	}(req.Email)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account exists for that email, password reset instructions have been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a reset token. All existing sessions are logged out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /password/reset [post]
+
+func (pc *PasswordController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pc.passwordService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
+}
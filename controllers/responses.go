@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondPasswordPolicyError writes a 400 listing every violated password rule.
+// It reports false, writing nothing, when err is not a policy violation.
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *utils.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the password policy",
+		"violations": policyErr.Violations,
+	})
+	return true
+}
+
+// currentUserID returns the authenticated user's ID set by AuthMiddleware
+func currentUserID(c *gin.Context) (uint, bool) {
+	userIDAny, _ := c.Get("userID") // must match key used in AuthMiddleware
+	userID, ok := userIDAny.(uint)
+	return userID, ok
+}
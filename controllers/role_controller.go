@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RoleController handles role and permission administration
+type RoleController struct {
+	roleService *services.RoleService
+}
+
+// NewRoleController creates a new RoleController
+func NewRoleController(db *gorm.DB) *RoleController {
+	return &RoleController{
+		roleService: services.NewRoleService(db),
+	}
+}
+
+// RoleRequest is the payload accepted when creating or updating a role
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=20"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserRolesRequest is the payload accepted by PUT /admin/users/:id/roles
+type UserRolesRequest struct {
+	RoleIDs []uint `json:"role_ids"`
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List all roles with their permissions
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/roles [get]
+
+func (rc *RoleController) ListRoles(c *gin.Context) {
+	roles, err := rc.roleService.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRoleByID godoc
+// @Summary Get a role
+// @Tags admin
+// @Produce json
+// @Param id path int true "Role ID"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/roles/{id} [get]
+
+func (rc *RoleController) GetRoleByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	role, err := rc.roleService.GetRoleByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// CreateRole godoc
+// @Summary Create a role
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role body RoleRequest true "Role data"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/roles [post]
+
+func (rc *RoleController) CreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := rc.roleService.CreateRole(req.Name, req.Description, req.Permissions)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownPermission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role
+// @Description Rename a role and replace its permissions. A role cannot be renamed while it is some user's primary role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body RoleRequest true "Role data"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/roles/{id} [put]
+
+func (rc *RoleController) UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := rc.roleService.UpdateRole(uint(id), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		case errors.Is(err, services.ErrUnknownPermission):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+		case errors.Is(err, services.ErrProtectedRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be renamed"})
+		case errors.Is(err, services.ErrRoleInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "Move users with this primary role to another role before renaming it"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role
+// @Description Delete a role and unassign it from users holding it as an additional role. A role cannot be deleted while it is some user's primary role.
+// @Tags admin
+// @Param id path int true "Role ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/roles/{id} [delete]
+
+func (rc *RoleController) DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return
+	}
+
+	if err := rc.roleService.DeleteRole(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		case errors.Is(err, services.ErrProtectedRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		case errors.Is(err, services.ErrRoleInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": "Move users with this primary role to another role before deleting it"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		}
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListPermissions godoc
+// @Summary List permissions
+// @Description List the permission catalogue roles can grant
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.Permission
+// @Failure 500 {object} gin.H
+// @Router /admin/permissions [get]
+
+func (rc *RoleController) ListPermissions(c *gin.Context) {
+	perms, err := rc.roleService.ListPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+	c.JSON(http.StatusOK, perms)
+}
+
+// SetUserRoles godoc
+// @Summary Assign roles to a user
+// @Description Replace the additional roles of a user. The primary role on the account is unchanged.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param roles body UserRolesRequest true "Role IDs"
+// @Success 200 {object} models.User
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/users/{id}/roles [put]
+
+func (rc *RoleController) SetUserRoles(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := rc.roleService.SetUserRoles(uint(id), req.RoleIDs)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User or role not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign roles"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"gocheck/models"
+	"gocheck/services"
+	"gocheck/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SessionController lets users see and end their own login sessions
+type SessionController struct {
+	sessionService *services.SessionService
+	auditService   *services.AuditService
+}
+
+// NewSessionController creates a new SessionController
+func NewSessionController(db *gorm.DB) *SessionController {
+	return &SessionController{
+		sessionService: services.NewSessionService(db),
+		auditService:   services.NewAuditService(db),
+	}
+}
+
+// SessionResponse describes one login session of the current user
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"` // The session the request was made with
+}
+
+// ListSessions godoc
+// @Summary List my sessions
+// @Description List the devices the current user is logged in on, most recently used first
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me/sessions [get]
+
+func (sc *SessionController) ListSessions(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := sc.sessionService.ListSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	currentID := currentSessionID(c)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{Session: session, Current: session.ID == currentID})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession godoc
+// @Summary Log out a device
+// @Description End one of the current user's sessions, e.g. on a lost phone. Its access and refresh tokens stop working immediately; other sessions and the password are unaffected.
+// @Tags sessions
+// @Param id path string true "Session ID"
+// @Success 204 "No Content"
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me/sessions/{id} [delete]
+
+func (sc *SessionController) RevokeSession(c *gin.Context) {
+	userID, ok := firstPartyUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID := c.Param("id")
+	if err := sc.sessionService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	recordAudit(sc.auditService, newAuditEvent(c, "session.revoke", "session", sessionID, models.AuditOutcomeAllowed, ""))
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// currentSessionID returns the login session of the request's access token, or "" if it has none
+func currentSessionID(c *gin.Context) string {
+	claimsAny, _ := c.Get("claims")
+	if claims, ok := claimsAny.(*utils.Claims); ok {
+		return claims.SessionID
+	}
+	return ""
+}
@@ -1,12 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"gocheck/config"
+	"gocheck/mailer"
+	"gocheck/middleware"
 	"gocheck/models"
+	"gocheck/policy"
 	"gocheck/services"
 	"gocheck/utils"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,19 +21,39 @@ import (
 
 // UserController handles user-related HTTP requests
 type UserController struct {
-	userService *services.UserService
+	db                  *gorm.DB
+	userPolicy          policy.Authorizer
+	auditService        *services.AuditService
+	userService         *services.UserService
+	tokenService        *services.TokenService
+	sessionService      *services.SessionService
+	verificationService *services.VerificationService
+	mfaService          *services.MFAService
+	loginThrottler      *services.LoginThrottler
 }
 
+// loginThrottler is shared by the password and second-factor login steps, so
+// failures at either step count toward the same lockouts
+var loginThrottler = services.NewLoginThrottler(services.NewMemoryAttemptStore())
+
 // NewUserController creates a new UserController
 func NewUserController(db *gorm.DB) *UserController {
 	return &UserController{
-		userService: services.NewUserService(db),
+		db:                  db,
+		userPolicy:          policy.UserPolicy{},
+		auditService:        services.NewAuditService(db),
+		userService:         services.NewUserService(db),
+		tokenService:        services.NewTokenService(db),
+		sessionService:      services.NewSessionService(db),
+		verificationService: services.NewVerificationService(db, mailer.NewFromConfig()),
+		mfaService:          services.NewMFAService(db),
+		loginThrottler:      loginThrottler,
 	}
 }
 
 // CreateUser godoc
 // @Summary Create a new user
-// @Description Create a new user with role validation
+// @Description Create a new user with role validation. Unavailable when OPEN_REGISTRATION is off; new users then register through POST /invitations/{token}/accept.
 // @Tags users
 // @Accept json
 // @Produce json
@@ -37,6 +64,11 @@ func NewUserController(db *gorm.DB) *UserController {
 // @Router /users [post]
 
 func (uc *UserController) CreateUser(c *gin.Context) {
+	if !config.AppConfig.OpenRegistration {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is by invitation only"})
+		return
+	}
+
 	var user models.User
 
 	if err := c.ShouldBindJSON(&user); err != nil {
@@ -58,26 +90,47 @@ func (uc *UserController) CreateUser(c *gin.Context) {
 		}
 	}
 
-	if err := uc.userService.CreateUser(&user); err != nil {
+	if err := uc.userService.WithActor(auditActor(c)).CreateUser(&user); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	// The account exists either way; a failed email can be retried via the resend endpoint
+	if err := uc.verificationService.SendVerification(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	userResponse := gin.H{
+		"id":             user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+	}
+
+	if config.AppConfig.RequireEmailVerification {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "User created successfully. Please verify your email address before logging in",
+			"user":    userResponse,
+		})
+		return
+	}
+
+	tokens, err := uc.tokenService.StartSession(&user, services.TokenGrant{}, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"role":     user.Role,
-		},
-		"token": token,
+		"message":       "User created successfully",
+		"user":          userResponse,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -89,7 +142,8 @@ func (uc *UserController) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := uc.userService.GetUserByID(uint(id))
+	// Only users of the caller's organization, or other unaffiliated users, are visible
+	user, err := uc.users(c).GetUserByID(uint(id))
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -104,11 +158,13 @@ func (uc *UserController) GetUserByID(c *gin.Context) {
 
 // GetAllUsers godoc
 // @Summary List all users
-// @Description Get a list of all users, paginated
+// @Description Get a list of the users in the caller's organization, paginated
 // @Tags users
 // @Accept json
 // @Produce json
 // @Success 200 {array} models.User
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /users [get]
 
@@ -126,7 +182,7 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	users, total, err := uc.userService.GetUsersPaginated(limit, offset)
+	users, total, err := uc.users(c).GetUsersPaginated(limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
@@ -144,16 +200,27 @@ func (uc *UserController) GetAllUsers(c *gin.Context) {
 	})
 }
 
+// UpdateUserRequest is the payload accepted by PUT /users/:id. Role may only be
+// changed by users holding roles:manage.
+type UpdateUserRequest struct {
+	Name     *models.Name `json:"name" binding:"required"`
+	Username string       `json:"username" binding:"required"`
+	Email    string       `json:"email" binding:"required,email"`
+	Role     string       `json:"role"`
+}
+
 // UpdateUser godoc
 // @Summary Update a user
-// @Description Update user info by ID
+// @Description Update user info by ID. Users may update themselves; admins may update anyone and change roles.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
-// @Param user body models.User true "User data"
+// @Param user body UpdateUserRequest true "User data"
 // @Success 200 {object} models.User
 // @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /users/{id} [put]
 
@@ -165,22 +232,286 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	user.ID = uint(id)
 
-	updatedUser, err := uc.userService.UpdateUser(&user)
+	actor, err := middleware.CurrentActor(c, uc.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+
+	target, err := uc.users(c).GetUserByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	actions := []string{policy.ActionUpdateUser}
+	roleChanged := req.Role != "" && req.Role != target.Role
+	if roleChanged {
+		actions = append(actions, policy.ActionChangeUserRole)
+	}
+	for _, action := range actions {
+		if err := uc.userPolicy.Authorize(actor, action, target); err != nil {
+			uc.audit(c, actor.UserID, action, target.ID, models.AuditOutcomeDenied, "")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: you may not perform this change"})
+			return
+		}
+	}
+
+	user := models.User{ID: target.ID, Name: req.Name, Username: req.Username, Email: req.Email, Role: req.Role}
+	updatedUser, err := uc.users(c).UpdateUser(&user)
 	if err != nil {
+		uc.audit(c, actor.UserID, actions[len(actions)-1], target.ID, models.AuditOutcomeFailed, err.Error())
+		if errors.Is(err, services.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	// The change itself is audited by UserService, together with its diff
+	if roleChanged {
+		// Tokens carry the role, so outstanding ones must not keep the old one alive
+		if err := uc.tokenService.RevokeAllForUser(target.ID); err != nil {
+			log.Printf("Failed to revoke tokens after role change for user %d: %v", target.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, updatedUser)
+}
+
+// UserStatusRequest is the payload accepted by PUT /admin/users/:id/status
+type UserStatusRequest struct {
+	Status         string     `json:"status" binding:"required,oneof=active suspended deactivated"`
+	Reason         string     `json:"reason" binding:"max=500"`
+	SuspendedUntil *time.Time `json:"suspended_until"` // Optional end of a suspension; omit to suspend indefinitely
+}
+
+// SetUserStatus godoc
+// @Summary Change a user's account status
+// @Description Suspend (optionally until a given time), deactivate or reactivate a user. Disabling an account logs it out everywhere; its tokens and API keys stop working immediately. Admin accounts can only be disabled by holders of roles:manage.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body UserStatusRequest true "New status, reason and optional suspension end"
+// @Success 200 {object} models.User
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/users/{id}/status [put]
+
+func (uc *UserController) SetUserStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actor, err := middleware.CurrentActor(c, uc.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+
+	target, err := uc.users(c).GetUserByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	detail := fmt.Sprintf("%s -> %s", target.EffectiveStatus(time.Now()), req.Status)
+	if err := uc.userPolicy.Authorize(actor, policy.ActionChangeUserStatus, target); err != nil {
+		uc.audit(c, actor.UserID, policy.ActionChangeUserStatus, target.ID, models.AuditOutcomeDenied, detail)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: you may not change the status of this account"})
+		return
+	}
+
+	updatedUser, err := uc.users(c).SetStatus(target.ID, req.Status, req.Reason, req.SuspendedUntil)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "suspended_until must be in the future"})
+			return
+		}
+		uc.audit(c, actor.UserID, policy.ActionChangeUserStatus, target.ID, models.AuditOutcomeFailed, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change account status"})
+		return
+	}
+
+	// Reactivation must not bring back sessions that were open before the account was disabled
+	if req.Status != models.UserStatusActive {
+		if err := uc.tokenService.RevokeAllForUser(target.ID); err != nil {
+			log.Printf("Failed to revoke tokens after status change for user %d: %v", target.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, updatedUser)
 }
 
+// DeactivateAccountRequest is the payload accepted by POST /users/:id/deactivate
+type DeactivateAccountRequest struct {
+	Password string `json:"password" binding:"required,max=72"`
+	Reason   string `json:"reason" binding:"max=500"`
+}
+
+// DeactivateAccount godoc
+// @Summary Deactivate own account
+// @Description Deactivate the current user's account after confirming the password. All sessions are logged out and the account can only be reactivated by an admin. Data such as books is kept.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body DeactivateAccountRequest true "Current password and optional reason"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /users/{id}/deactivate [post]
+
+func (uc *UserController) DeactivateAccount(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok || userID != uint(id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only deactivate your own account"})
+		return
+	}
+
+	var req DeactivateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := uc.users(c).DeactivateUser(userID, req.Password, req.Reason); err != nil {
+		if errors.Is(err, services.ErrIncorrectPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+		uc.audit(c, userID, "user.deactivate", userID, models.AuditOutcomeFailed, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account"})
+		return
+	}
+
+	if err := uc.tokenService.RevokeAllForUser(userID); err != nil {
+		log.Printf("Failed to revoke tokens after deactivation of user %d: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
+}
+
+// ChangePasswordRequest is the payload accepted by PUT /users/:id/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=72"`
+	NewPassword     string `json:"new_password" binding:"required,max=72"`
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the current user's password. Other sessions are logged out and a fresh token pair is returned.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /users/{id}/password [put]
+
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok || userID != uint(id) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own password"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := uc.users(c).ChangePassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrIncorrectPassword) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Log out every session, then start a new one for the caller so they stay signed in
+	if err := uc.tokenService.RevokeAllForUser(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke existing sessions"})
+		return
+	}
+
+	user, err := uc.users(c).GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+		return
+	}
+
+	// Keep the second-factor status, scopes and organization of the session that changed the password
+	mfa, _ := c.Get("mfa")
+	mfaVerified, _ := mfa.(bool)
+	scopes, _ := middleware.Scopes(c)
+
+	tokens, err := uc.tokenService.StartSession(user, services.TokenGrant{MFA: mfaVerified, Scopes: scopes, OrgID: middleware.OrganizationID(c)}, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed successfully",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
 // DeleteUser godoc
 // @Summary Delete a user
 // @Description Delete user by ID
@@ -188,6 +519,7 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 // @Param id path int true "User ID"
 // @Success 204 "No Content"
 // @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /users/{id} [delete]
 
@@ -199,7 +531,11 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := uc.userService.DeleteUser(uint(id)); err != nil {
+	if err := uc.users(c).DeleteUser(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
@@ -209,7 +545,7 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 
 // Login godoc
 // @Summary User login
-// @Description Authenticate user and return token
+// @Description Authenticate user and return token. An optional space-separated "scope" (e.g. "books:read") limits what the tokens can do.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -238,26 +574,342 @@ func (uc *UserController) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
 		return
 	}
+	if len(password) > utils.MaxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at most %d bytes long", utils.MaxPasswordLength)})
+		return
+	}
+
+	// An optional space-separated "scope" limits what the issued tokens can do
+	scopes, err := utils.ParseScope(loginData["scope"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "known_scopes": utils.KnownScopes})
+		return
+	}
+
+	// Refuse locked accounts and IPs before spending a bcrypt comparison on them
+	if wait, err := uc.loginThrottler.Check(email, c.ClientIP()); err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Please try again later"})
+		return
+	}
 
 	authenticatedUser, err := uc.userService.AuthenticateUser(email, password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		switch {
+		case errors.Is(err, services.ErrAccountSuspended), errors.Is(err, services.ErrAccountDeactivated):
+			// The password was right, so this is not a failed attempt
+			uc.loginThrottler.RecordSuccess(email)
+			middleware.RespondAccountStatus(c, err)
+		case errors.Is(err, services.ErrEmailNotVerified):
+			uc.loginThrottler.RecordSuccess(email)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		case errors.Is(err, services.ErrInvalidCredentials):
+			uc.loginThrottler.RecordFailure(email, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+	uc.loginThrottler.RecordSuccess(email)
+
+	// Accounts with TOTP get a short-lived pending token to exchange at /login/mfa
+	if authenticatedUser.TOTPEnabled {
+		mfaToken, err := uc.mfaService.IssuePendingToken(authenticatedUser, scopes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
 		return
 	}
 
-	token, err := utils.GenerateToken(authenticatedUser.ID, authenticatedUser.Role)
+	tokens, err := uc.tokenService.StartSession(authenticatedUser, services.TokenGrant{Scopes: scopes}, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"message": "Login successful",
 		"user": gin.H{
 			"ID":       authenticatedUser.ID,
 			"username": authenticatedUser.Username,
 			"email":    authenticatedUser.Email,
 		},
-		"token": token,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	}
+	if required, err := uc.mfaService.RequiresMFA(authenticatedUser); err != nil {
+		log.Printf("Failed to check two-factor requirement for user %d: %v", authenticatedUser.ID, err)
+	} else if required {
+		// Privileged routes stay closed until the user enrolls and logs in with TOTP
+		response["mfa_enrollment_required"] = true
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshTokenRequest is the payload accepted by POST /token/refresh
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access/refresh token pair. Refresh tokens are single-use; presenting a used one revokes its whole family.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} services.TokenPair
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /token/refresh [post]
+
+func (uc *UserController) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := uc.tokenService.Refresh(req.RefreshToken, "", nil)
+	if err != nil {
+		if middleware.RespondAccountStatus(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used; please log in again"})
+		case errors.Is(err, services.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LogoutRequest is the optional payload accepted by POST /logout
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description End the login session of the presented access token, revoking its access and refresh tokens. A refresh token in the body is revoked as well.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body LogoutRequest false "Refresh token to revoke"
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /logout [post]
+
+func (uc *UserController) Logout(c *gin.Context) {
+	claimsAny, _ := c.Get("claims")
+	claims, ok := claimsAny.(*utils.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// The body is optional; a missing or empty body only revokes the access token
+	var req LogoutRequest
+	_ = c.ShouldBindJSON(&req)
+
+	if err := uc.tokenService.RevokeAccessToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	if claims.SessionID != "" {
+		err := uc.sessionService.RevokeSession(claims.UserID, claims.SessionID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		err := uc.tokenService.RevokeRefreshToken(claims.UserID, req.RefreshToken)
+		if err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Invalidate every access and refresh token issued to the current user
+// @Tags auth
+// @Produce json
+// @Success 200 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /logout/all [post]
+
+func (uc *UserController) LogoutAll(c *gin.Context) {
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := uc.tokenService.RevokeAllForUser(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm an email address using the signed link sent at registration
+// @Tags users
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /users/verify [get]
+
+func (uc *UserController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+		return
+	}
+
+	user, err := uc.verificationService.Verify(token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+		"email":   user.Email,
 	})
 }
+
+// ResendVerificationRequest is the payload accepted by POST /users/verify/resend
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification link. The response is the same whether or not the address is registered.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ResendVerificationRequest true "Account email"
+// @Success 202 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /users/verify/resend [post]
+
+func (uc *UserController) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := uc.verificationService.ResendVerification(req.Email); err != nil {
+		log.Printf("Failed to resend verification email: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an unverified account exists for that email, a new link has been sent"})
+}
+
+// ListLockouts godoc
+// @Summary List login lockouts
+// @Description List accounts and client IPs currently locked out after failed logins (admin only)
+// @Tags admin
+// @Produce json
+// @Success 200 {array} services.Lockout
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Router /admin/lockouts [get]
+
+func (uc *UserController) ListLockouts(c *gin.Context) {
+	lockouts := uc.loginThrottler.Lockouts()
+	if lockouts == nil {
+		lockouts = []services.Lockout{}
+	}
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// ClearLockout godoc
+// @Summary Clear a login lockout
+// @Description Remove the lockout and failure history of an account, a user's second factor and/or a client IP (admin only)
+// @Tags admin
+// @Produce json
+// @Param email query string false "Account email"
+// @Param user_id query int false "User ID whose two-factor lockout to clear"
+// @Param ip query string false "Client IP"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Router /admin/lockouts [delete]
+
+func (uc *UserController) ClearLockout(c *gin.Context) {
+	email := c.Query("email")
+	ip := c.Query("ip")
+	userID := c.Query("user_id")
+	if email == "" && ip == "" && userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide an email, user_id or ip query parameter"})
+		return
+	}
+
+	if userID != "" {
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		uc.loginThrottler.ClearMFA(uint(id))
+	}
+
+	if email != "" {
+		uc.loginThrottler.ClearAccount(email)
+	}
+	if ip != "" {
+		uc.loginThrottler.ClearIP(ip)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
+
+// users returns the user service for an authenticated request: confined to the
+// caller's organization and auditing mutations as the caller
+func (uc *UserController) users(c *gin.Context) *services.UserService {
+	return uc.userService.WithActor(auditActor(c)).WithTenant(middleware.OrganizationID(c))
+}
+
+// audit records an attempted action on a user account
+func (uc *UserController) audit(c *gin.Context, actorID uint, action string, targetID uint, outcome, detail string) {
+	event := newAuditEvent(c, action, "user", strconv.FormatUint(uint64(targetID), 10), outcome, detail)
+	event.ActorID = actorID
+	recordAudit(uc.auditService, event)
+}
@@ -51,11 +51,30 @@ func Migrate(db *gorm.DB) {
 	//db.Migrator().AddColumn(&models.User{}, "Role")
 	err := db.AutoMigrate(
 		&models.User{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.Invitation{},
 		&models.Book{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.Permission{},
+		&models.Role{},
+		&models.AuditEvent{},
+		&models.APIKey{},
+		&models.OAuthClient{},
+		&models.OAuthAuthorizationCode{},
+		&models.UserIdentity{},
 	)
 
 	if err != nil {
 		log.Fatalf("Database migration failed: %v", err)
 	}
+
+	if err := SeedRBAC(db); err != nil {
+		log.Fatalf("Seeding roles and permissions failed: %v", err)
+	}
 	log.Println("Database migrations completed.")
 }
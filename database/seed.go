@@ -0,0 +1,78 @@
+package database
+
+import (
+	"gocheck/models"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// DefaultPermissions is the catalogue of permissions the application checks
+var DefaultPermissions = []models.Permission{
+	{Name: "books:read", Description: "Read any user's books"},
+	{Name: "books:update", Description: "Edit any user's books"},
+	{Name: "books:delete", Description: "Delete any user's books"},
+	{Name: "users:read", Description: "View any user's account"},
+	{Name: "users:update", Description: "Edit any user's account"},
+	{Name: "users:delete", Description: "Delete user accounts"},
+	{Name: "users:invite", Description: "Invite new users to register"},
+	{Name: "roles:manage", Description: "Create, edit and assign roles"},
+	{Name: "security:manage", Description: "View and clear login lockouts"},
+	{Name: "orgs:manage", Description: "Create organizations and manage any organization's members"},
+}
+
+// defaultRoles maps the built-in roles to the permissions they start with.
+// Admin is always kept in sync with the full catalogue.
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{"admin", "Full access", nil},
+	{"librarian", "Can edit any book", []string{"books:read", "books:update"}},
+	{"user", "Manages their own books and account", nil},
+}
+
+// SeedRBAC creates missing permissions and built-in roles. It is idempotent and
+// leaves changes made through the admin endpoints alone, except that the admin
+// role always receives every permission.
+func SeedRBAC(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		byName := make(map[string]models.Permission)
+		for _, p := range DefaultPermissions {
+			perm := p
+			if err := tx.Where(models.Permission{Name: perm.Name}).Attrs(models.Permission{Description: perm.Description}).FirstOrCreate(&perm).Error; err != nil {
+				return err
+			}
+			byName[perm.Name] = perm
+		}
+
+		for _, r := range defaultRoles {
+			var role models.Role
+			result := tx.Where(models.Role{Name: r.Name}).Attrs(models.Role{Description: r.Description}).FirstOrCreate(&role)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			var perms []models.Permission
+			switch {
+			case r.Name == "admin":
+				for _, p := range byName {
+					perms = append(perms, p)
+				}
+			case result.RowsAffected == 1:
+				for _, name := range r.Permissions {
+					perms = append(perms, byName[name])
+				}
+			}
+			if len(perms) > 0 {
+				if err := tx.Model(&role).Association("Permissions").Append(perms); err != nil {
+					return err
+				}
+			}
+		}
+
+		log.Println("Roles and permissions seeded.")
+		return nil
+	})
+}
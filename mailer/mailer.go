@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"fmt"
+	"gocheck/config"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message is an outgoing plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewFromConfig returns the mailer selected by config.AppConfig.Mail.Driver
+func NewFromConfig() Mailer {
+	switch config.AppConfig.Mail.Driver {
+	case "file":
+		return NewFileMailer(config.AppConfig.Mail.FilePath, config.AppConfig.Mail.From)
+	default:
+		return NewLogMailer(config.AppConfig.Mail.From)
+	}
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// It is intended for local development.
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer creates a new LogMailer
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer appends messages to a file, which makes delivered mail easy to
+// inspect from tests and staging environments.
+type FileMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewFileMailer creates a new FileMailer writing to path
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+// Send appends the message to the mail file
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z), m.from, msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"fmt"
+	"gocheck/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileMailerAppendsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFileMailer(path, "noreply@example.com")
+
+	messages := []Message{
+		{To: "alice@example.com", Subject: "Reset your password", Body: "Follow http://localhost/reset?token=abc"},
+		{To: "bob@example.com", Subject: "Verify your email", Body: "Follow http://localhost/verify?token=def"},
+	}
+	for _, msg := range messages {
+		if err := m.Send(msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read mail file: %v", err)
+	}
+	content := string(data)
+	for _, msg := range messages {
+		for _, want := range []string{"From: noreply@example.com", "To: " + msg.To, "Subject: " + msg.Subject, msg.Body} {
+			if !strings.Contains(content, want) {
+				t.Errorf("mail file is missing %q:\n%s", want, content)
+			}
+		}
+	}
+	if strings.Index(content, messages[0].Body) > strings.Index(content, messages[1].Body) {
+		t.Error("messages are not in sending order")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat mail file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mail file permissions = %o, want 600", perm)
+	}
+}
+
+func TestFileMailerConcurrentSends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := NewFileMailer(path, "noreply@example.com")
+
+	const senders = 20
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := m.Send(Message{To: fmt.Sprintf("user%d@example.com", i), Subject: "Hello", Body: "Body"}); err != nil {
+				t.Errorf("Send: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read mail file: %v", err)
+	}
+	if got := strings.Count(string(data), "Subject: Hello\n"); got != senders {
+		t.Errorf("mail file has %d messages, want %d", got, senders)
+	}
+}
+
+func TestFileMailerReportsUnwritablePath(t *testing.T) {
+	m := NewFileMailer(filepath.Join(t.TempDir(), "missing", "mail.log"), "noreply@example.com")
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Hello"}); err == nil {
+		t.Error("Send to a missing directory succeeded")
+	}
+}
+
+func TestNewFromConfigSelectsDriver(t *testing.T) {
+	saved := config.AppConfig.Mail
+	t.Cleanup(func() { config.AppConfig.Mail = saved })
+
+	config.AppConfig.Mail.Driver = "file"
+	config.AppConfig.Mail.FilePath = filepath.Join(t.TempDir(), "mail.log")
+	if _, ok := NewFromConfig().(*FileMailer); !ok {
+		t.Error("driver \"file\" did not select FileMailer")
+	}
+
+	config.AppConfig.Mail.Driver = ""
+	if _, ok := NewFromConfig().(*LogMailer); !ok {
+		t.Error("default driver did not select LogMailer")
+	}
+}
@@ -10,7 +10,11 @@ package main
 import (
 	"gocheck/config"
 	"gocheck/database"
+	"gocheck/middleware"
 	"gocheck/routes"
+	"gocheck/services"
+	"gocheck/utils"
+	"time"
 
 	_ "gocheck/docs"
 	"log"
@@ -27,6 +31,11 @@ func main() {
 		log.Fatalf("Error loading config: %v", err)
 	}
 
+	// Load the keys used to sign and verify tokens
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("Error loading signing keys: %v", err)
+	}
+
 	// Initialize database
 	db, err := database.InitDB()
 	if err != nil {
@@ -36,12 +45,31 @@ func main() {
 	// Auto-migrate models
 	database.Migrate(db)
 
+	// Periodically purge expired token revocations and refresh tokens
+	go services.NewTokenService(db).StartCleanup(time.Hour)
+
 	// Create a single Gin router instance
 	router := gin.Default()
+	// Client IPs feed login throttling, sessions and the audit log, so only take
+	// them from X-Forwarded-For when a configured proxy set the header
+	if err := router.SetTrustedProxies(config.AppConfig.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(middleware.RequestID())
 
 	// Register your application routes on this router
 	routes.SetupUserRoutes(router, db)
+	routes.RegisterMeRoutes(router, db)
 	routes.RegisterBookRoutes(router, db)
+	routes.RegisterKeyRoutes(router)
+	routes.RegisterRoleRoutes(router, db)
+	routes.RegisterImpersonationRoutes(router, db)
+	routes.RegisterAuditRoutes(router, db)
+	routes.RegisterOrganizationRoutes(router, db)
+	routes.RegisterInvitationRoutes(router, db)
+	routes.RegisterAPIKeyRoutes(router, db)
+	routes.RegisterOAuthRoutes(router, db)
+	routes.RegisterOIDCRoutes(router, db)
 
 	// Register swagger handler on the same router
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -1,16 +1,33 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
-	"gocheck/utils"
+	"gocheck/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the request with either a Bearer JWT, rejecting
+// tokens that were revoked server-side, or a personal API key sent as
+// "X-API-Key: KEY" or "Authorization: ApiKey KEY". Both set the same context values.
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	tokenService := services.NewTokenService(db)
+	apiKeyService := services.NewAPIKeyService(db)
+	auditService := services.NewAuditService(db)
+	orgService := services.NewOrganizationService(db)
+	sessionService := services.NewSessionService(db)
+
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKeyService, orgService, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -19,17 +36,23 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "apikey" {
+			authenticateAPIKey(c, apiKeyService, orgService, parts[1])
+			return
+		}
 		if !(len(parts) == 2 && strings.ToLower(parts[0]) == "bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be 'Bearer TOKEN'"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be 'Bearer TOKEN' or 'ApiKey KEY'"})
 			c.Abort()
 			return
 		}
 
 		tokenString := parts[1]
 
-		claims, err := utils.ValidateToken(tokenString)
+		claims, err := tokenService.ValidateAccessToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			if !RespondAccountStatus(c, err) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			}
 			c.Abort()
 			return
 		}
@@ -37,11 +60,86 @@ func AuthMiddleware() gin.HandlerFunc {
 		// ✅ Store both userID and userRole in context
 		c.Set("userID", claims.UserID)
 		c.Set("userRole", claims.Role) // this is what was missing
+		c.Set("claims", claims)        // full claims, e.g. the jti needed for logout
+		c.Set("mfa", claims.MFA)       // whether this session completed a second factor
+		if scopes := claims.Scopes(); len(scopes) > 0 {
+			c.Set("scopes", scopes) // only scoped tokens are limited, see RequireScope
+		}
+		if !setTenant(c, orgService, claims.UserID, claims.OrgID) {
+			return
+		}
+		if claims.SessionID != "" {
+			// ValidateAccessToken has checked the session is live; this only feeds GET /me/sessions
+			if err := sessionService.Touch(claims.SessionID, c.ClientIP()); err != nil {
+				log.Printf("Failed to update last-seen time of session %s: %v", claims.SessionID, err)
+			}
+		}
+
+		if claims.Act != nil {
+			c.Set("actorID", claims.Act.UserID) // the admin impersonating userID, see RealUserID
+			auditImpersonatedRequest(c, auditService, claims.UserID, claims.Act.UserID)
+			return
+		}
 
 		c.Next()
 	}
 }
 
+// OptionalAuthMiddleware authenticates the request like AuthMiddleware when it
+// carries credentials and lets anonymous requests through unchanged. Handlers
+// tell the two apart with the userID context value.
+func OptionalAuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	authenticate := AuthMiddleware(db)
+
+	return func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") == "" && c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// authenticateAPIKey sets the context for a request made with a personal API key.
+// API keys never satisfy a two-factor requirement, and "claims" is left unset.
+func authenticateAPIKey(c *gin.Context, apiKeyService *services.APIKeyService, orgService *services.OrganizationService, rawKey string) {
+	key, user, err := apiKeyService.Authenticate(strings.TrimSpace(rawKey))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		} else if !RespondAccountStatus(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate API key"})
+		}
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", user.ID)
+	c.Set("userRole", user.Role)
+	c.Set("apiKeyID", key.ID)
+	c.Set("scopes", key.ScopeList())
+	if !setTenant(c, orgService, user.ID, key.OrgID) {
+		return
+	}
+
+	c.Next()
+}
+
+// RespondAccountStatus writes a 403 when the credentials are valid but belong to a
+// suspended or deactivated account, reporting whether it did. Controllers use it
+// for the same errors from login and token endpoints.
+func RespondAccountStatus(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrAccountSuspended):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is suspended"})
+	case errors.Is(err, services.ErrAccountDeactivated):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+	default:
+		return false
+	}
+	return true
+}
+
 func RoleAuthorization(requiredRole string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		roleAny, exists := c.Get("userRole") // must match key used in AuthMiddleware
@@ -51,6 +149,26 @@ func RoleAuthorization(requiredRole string) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+
+		// Roles that mandate 2FA may only act from a session that completed TOTP
+		if !mfaSatisfied(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required: enroll via /mfa/totp/enroll and log in with a code"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
+
+// mfaSatisfied reports whether the caller may use privileged routes: either their
+// role does not mandate two-factor authentication or this session completed it
+func mfaSatisfied(c *gin.Context) bool {
+	roleAny, _ := c.Get("userRole")
+	role, _ := roleAny.(string)
+	if !services.RoleRequiresMFA(role) {
+		return true
+	}
+	mfa, _ := c.Get("mfa")
+	mfaVerified, _ := mfa.(bool)
+	return mfaVerified
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"gocheck/policy"
+	"gocheck/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Permissions returns the permissions of the authenticated user. They are loaded
+// once per request and cached in the context, so several checks cost one query.
+func Permissions(c *gin.Context, db *gorm.DB) (map[string]bool, error) {
+	if cached, exists := c.Get("permissions"); exists {
+		if perms, ok := cached.(map[string]bool); ok {
+			return perms, nil
+		}
+	}
+
+	userIDAny, _ := c.Get("userID") // must match key used in AuthMiddleware
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		return nil, errors.New("no authenticated user in context")
+	}
+
+	perms, err := services.NewRoleService(db).PermissionsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("permissions", perms)
+	return perms, nil
+}
+
+// HasPermission reports whether the authenticated user holds the permission
+func HasPermission(c *gin.Context, db *gorm.DB, permission string) (bool, error) {
+	perms, err := Permissions(c, db)
+	if err != nil {
+		return false, err
+	}
+	return perms[permission], nil
+}
+
+// HasElevatedPermission is HasPermission for permissions that override resource
+// ownership; like RequirePermission it also demands two-factor authentication
+// before the permission is used
+func HasElevatedPermission(c *gin.Context, db *gorm.DB, permission string) (bool, error) {
+	allowed, err := HasPermission(c, db, permission)
+	if err != nil || !allowed {
+		return false, err
+	}
+	return permissionMFASatisfied(c), nil
+}
+
+// CurrentActor describes the authenticated user for policy decisions. Permissions
+// are withheld while the session lacks the second factor they require.
+func CurrentActor(c *gin.Context, db *gorm.DB) (policy.Actor, error) {
+	userIDAny, _ := c.Get("userID")
+	userID, ok := userIDAny.(uint)
+	if !ok {
+		return policy.Actor{}, errors.New("no authenticated user in context")
+	}
+	roleAny, _ := c.Get("userRole")
+	role, _ := roleAny.(string)
+
+	actor := policy.Actor{UserID: userID, Role: role, Permissions: map[string]bool{}}
+	actor.ImpersonatorID, _ = ImpersonatorID(c)
+	actor.OrgID = OrganizationID(c)
+	actor.OrgRole = OrganizationRole(c)
+	if !permissionMFASatisfied(c) {
+		return actor, nil
+	}
+	perms, err := Permissions(c, db)
+	if err != nil {
+		return policy.Actor{}, err
+	}
+	actor.Permissions = perms
+	return actor, nil
+}
+
+// RequirePermission allows the request only if the authenticated user holds the
+// permission through any of their roles. Use it after AuthMiddleware.
+func RequirePermission(db *gorm.DB, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := HasPermission(c, db, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		if !permissionMFASatisfied(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required: enroll via /mfa/totp/enroll and log in with a code"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// permissionMFASatisfied reports whether the caller may use an elevated permission.
+// The requirement follows from the permission itself, whichever role grants it;
+// with MFA_REQUIRED_FOR_PERMISSIONS off only roles that mandate 2FA need it.
+func permissionMFASatisfied(c *gin.Context) bool {
+	if !services.PermissionsRequireMFA() {
+		return mfaSatisfied(c)
+	}
+	mfa, _ := c.Get("mfa")
+	mfaVerified, _ := mfa.(bool)
+	return mfaVerified
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"regexp"
+
+	"gocheck/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validRequestID limits client-supplied request IDs to short, log-safe values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID tags every request with an ID, reusing a sane incoming X-Request-ID,
+// so log lines and audit events can be correlated. The ID is echoed in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			requestID, _ = utils.GenerateRandomToken(16)
+		}
+		c.Set("requestID", requestID)
+		c.Header("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or "" when the middleware is not installed
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("requestID")
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes returns the scopes the current credential is limited to. limited is
+// false for tokens without a scope claim, which carry their user's full power.
+func Scopes(c *gin.Context) (scopes []string, limited bool) {
+	scopesAny, exists := c.Get("scopes") // set by AuthMiddleware for scoped credentials
+	if !exists {
+		return nil, false
+	}
+	scopes, _ = scopesAny.([]string)
+	return scopes, true
+}
+
+// HasScope reports whether the current credential may be used for the scope
+func HasScope(c *gin.Context, scope string) bool {
+	scopes, limited := Scopes(c)
+	if !limited {
+		return true
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope allows the request only if the credential is unscoped or was
+// granted the scope. Use it after AuthMiddleware; it limits what a token can do
+// but never grants more than the user's own permissions.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: token lacks the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"gocheck/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// setTenant confirms the user still belongs to the organization their credential
+// is confined to and stores it in the context for tenant-scoped services. It
+// writes the error response and reports false otherwise.
+func setTenant(c *gin.Context, orgService *services.OrganizationService, userID, orgID uint) bool {
+	c.Set("orgID", orgID)
+	if orgID == 0 {
+		return true
+	}
+	membership, err := orgService.Membership(orgID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No longer a member of this organization; please log in again"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve organization"})
+		}
+		c.Abort()
+		return false
+	}
+	c.Set("orgRole", membership.Role)
+	return true
+}
+
+// OrganizationID returns the organization the request is confined to, 0 for none
+func OrganizationID(c *gin.Context) uint {
+	orgIDAny, _ := c.Get("orgID") // set by AuthMiddleware from the "org" claim
+	orgID, _ := orgIDAny.(uint)
+	return orgID
+}
+
+// OrganizationRole returns the caller's role in the request's organization, "" for none
+func OrganizationRole(c *gin.Context) string {
+	return c.GetString("orgRole")
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a user-owned credential for machine clients. Keys look like
+// "gk_<prefix>_<secret>": the prefix identifies the row and is safe to display,
+// and only a hash of the secret is stored.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"uniqueIndex;size:16;not null" json:"prefix"`
+	SecretHash string     `gorm:"size:64;not null" json:"-"`
+	Scopes     string     `gorm:"size:500" json:"-"`                // Space-separated, see ScopeList
+	OrgID      uint       `gorm:"not null;default:0" json:"org_id"` // Organization the key acts in; 0 for none
+	ExpiresAt  *time.Time `json:"expires_at"`                       // Nil means the key does not expire
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the scopes granted to the key
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
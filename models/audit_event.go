@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeAllowed = "allowed"
+	AuditOutcomeDenied  = "denied"
+	AuditOutcomeFailed  = "failed"
+)
+
+// ErrAuditEventImmutable is returned when something tries to change or delete an audit event
+var ErrAuditEventImmutable = errors.New("audit events are append-only")
+
+// AuditChange is the value of a single field before and after a mutation.
+// Before is nil for creations and After is nil for deletions.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChanges maps field names to their change; stored as JSON text
+type AuditChanges map[string]AuditChange
+
+// Value implements driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (c *AuditChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return fmt.Errorf("audit changes: unsupported type %T", value)
+	}
+}
+
+// AuditEvent records an attempted action, whether or not it was allowed.
+// Rows are only ever inserted; when the hash chain is enabled each row also
+// commits to its predecessor so edits and deletions can be detected.
+type AuditEvent struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	ActorID uint `gorm:"index" json:"actor_id"`
+	// Admin who performed the action while impersonating ActorID
+	ImpersonatorID *uint        `gorm:"index" json:"impersonator_id,omitempty"`
+	Action         string       `gorm:"index;size:100;not null" json:"action"`
+	TargetType     string       `gorm:"index:idx_audit_events_target;size:50" json:"target_type"`
+	TargetID       string       `gorm:"index:idx_audit_events_target;size:100" json:"target_id"`
+	Outcome        string       `gorm:"size:20;not null" json:"outcome"`
+	Detail         string       `json:"detail,omitempty"`
+	Changes        AuditChanges `gorm:"type:text" json:"changes,omitempty"` // Field-level diff of data-changing actions
+	IP             string       `gorm:"size:64" json:"ip"`
+	UserAgent      string       `json:"user_agent"`
+	RequestID      string       `gorm:"index;size:64" json:"request_id,omitempty"`
+	CreatedAt      time.Time    `gorm:"index" json:"created_at"`
+
+	// Hash chain; empty when AUDIT_HASH_CHAIN was off at the time of writing
+	PrevHash string `gorm:"size:64" json:"prev_hash,omitempty"`
+	Hash     string `gorm:"size:64;index" json:"hash,omitempty"`
+}
+
+// BeforeUpdate keeps audit events append-only
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// BeforeDelete keeps audit events append-only
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditEventImmutable
+}
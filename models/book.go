@@ -4,7 +4,8 @@ type Book struct {
 	ID     uint   `gorm:"primaryKey" json:"id"`
 	Title  string `json:"title"`
 	Author string `json:"author"`
-	UserID uint   `json:"user_id"` // Foreign key
+	UserID uint   `gorm:"index" json:"user_id"`                   // Owner; set from the authenticated user
+	OrgID  uint   `gorm:"index;not null;default:0" json:"org_id"` // Tenant the book was created in; 0 outside any organization
 
 	// Establishing the relationship to User with proper cascading
 	//User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OAuthClient is a third-party application registered with the OAuth2 authorization
+// server. Confidential clients authenticate with a secret, of which only a hash is
+// stored; public clients (e.g. mobile apps) have none and must use PKCE.
+type OAuthClient struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	ClientID     string     `gorm:"uniqueIndex;size:64;not null" json:"client_id"`
+	SecretHash   string     `gorm:"size:64" json:"-"`
+	Name         string     `gorm:"size:100;not null" json:"name"`
+	OwnerID      uint       `gorm:"index;not null" json:"owner_id"` // User who registered the client; client_credentials tokens act as this user
+	RedirectURIs string     `gorm:"type:text" json:"-"`             // Space-separated, compared exactly
+	Scopes       string     `gorm:"size:500;not null" json:"-"`     // Space-separated scopes the client may request
+	Confidential bool       `gorm:"not null;default:true" json:"confidential"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RedirectURIList returns the registered redirect URIs
+func (c *OAuthClient) RedirectURIList() []string {
+	return strings.Fields(c.RedirectURIs)
+}
+
+// ScopeList returns the scopes the client may request
+func (c *OAuthClient) ScopeList() []string {
+	return strings.Fields(c.Scopes)
+}
+
+// OAuthAuthorizationCode is a single-use code handed to a client after the user
+// consented, exchanged at the token endpoint together with the PKCE verifier
+type OAuthAuthorizationCode struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	CodeHash            string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	ClientID            string     `gorm:"index;size:64;not null" json:"client_id"`
+	UserID              uint       `gorm:"index;not null" json:"user_id"`
+	RedirectURI         string     `gorm:"type:text;not null" json:"redirect_uri"`
+	Scope               string     `gorm:"size:500" json:"scope"`
+	CodeChallenge       string     `gorm:"size:128;not null" json:"-"`
+	CodeChallengeMethod string     `gorm:"size:10;not null" json:"-"`
+	ExpiresAt           time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Roles a user can hold within an organization
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant. Books belong to the organization they were created
+// in (Book.OrgID) and are only visible to requests made in that organization.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;size:50;not null" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Memberships []OrganizationMembership `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Invitations []Invitation             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// OrganizationMembership makes a user part of an organization with a per-organization role
+type OrganizationMembership struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	OrganizationID uint      `gorm:"uniqueIndex:idx_org_member;not null" json:"organization_id"`
+	UserID         uint      `gorm:"uniqueIndex:idx_org_member;index;not null" json:"user_id"`
+	Role           string    `gorm:"size:20;not null;default:'member'" json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	Organization *Organization `json:"organization,omitempty"`
+}
+
+// Invitation lets whoever holds the emailed token register an account with the
+// given UserRole or, for an organization invitation, join the organization with
+// the given Role. Only a hash of the token is stored and it can be used once.
+type Invitation struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	OrganizationID *uint      `gorm:"index" json:"organization_id,omitempty"` // nil for a plain sign-up invitation
+	Email          string     `gorm:"size:255;not null" json:"email"`
+	Role           string     `gorm:"size:20;not null;default:''" json:"role,omitempty"` // Role in the organization
+	UserRole       string     `gorm:"size:20;not null;default:'user'" json:"user_role"`  // Account role if the invitee registers
+	TokenHash      string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	InvitedByID    uint       `json:"invited_by_id"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedByID   *uint      `json:"accepted_by_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// IsOrgRole reports whether role is a valid organization role
+func IsOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
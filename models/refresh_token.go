@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RefreshToken is a persisted, single-use token that can be exchanged for a new
+// access token. Every rotation creates a new row in the same family, so reuse of
+// an already-rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	FamilyID  string     `gorm:"index;size:64;not null" json:"family_id"`
+	MFA       bool       `gorm:"not null;default:false" json:"mfa"` // Family started with a second factor
+	Scope     string     `gorm:"size:500" json:"scope"`             // Scopes of the family; empty means unrestricted
+	ClientID  string     `gorm:"index;size:64" json:"client_id"`    // OAuth2 client of the family; empty for first-party logins
+	OrgID     uint       `gorm:"not null;default:0" json:"org_id"`  // Organization the family is confined to; 0 for none
+	SessionID string     `gorm:"index;size:64" json:"session_id"`   // Login session of the family; empty for OAuth2 clients
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
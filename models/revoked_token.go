@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken is a denylist entry for an access token that must no longer be accepted.
+// Entries are only needed until the token would have expired anyway and are purged after that.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"uniqueIndex;size:64;not null" json:"jti"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Permission is a single capability such as "books:update"
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Description string `json:"description"`
+}
+
+// Role groups permissions. Users can hold several roles; their permissions are the union.
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"uniqueIndex;size:20;not null" json:"name"` // Same size as users.role, which holds role names
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE;" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is one login on one device. Every token issued for the login carries
+// the session ID in its "sid" claim, so revoking the session signs the device
+// out without affecting the user's other logins.
+type Session struct {
+	ID          string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"-"`
+	DeviceLabel string     `gorm:"size:100" json:"device"` // Derived from the user agent, e.g. "Firefox on Linux"
+	UserAgent   string     `gorm:"size:500" json:"user_agent"`
+	IP          string     `gorm:"size:64" json:"ip"` // Address the session was last used from
+	CreatedAt   time.Time  `json:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `gorm:"index" json:"expires_at"` // Follows the expiry of the latest refresh token
+	RevokedAt   *time.Time `json:"-"`
+}
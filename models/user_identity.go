@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+// A provider account is identified by its issuer and subject, never by email.
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Issuer      string     `gorm:"uniqueIndex:idx_identity_issuer_subject;size:255;not null" json:"issuer"`
+	Subject     string     `gorm:"uniqueIndex:idx_identity_issuer_subject;size:255;not null" json:"subject"`
+	Email       string     `json:"email"` // Email asserted by the provider at the last login
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -1,18 +1,79 @@
 package models
 
+import "time"
+
 type Name struct {
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
 }
 
+// Account statuses stored in User.Status
+const (
+	UserStatusActive      = "active"
+	UserStatusSuspended   = "suspended"
+	UserStatusDeactivated = "deactivated"
+)
+
 type User struct {
 	ID       uint   `gorm:"primaryKey" json:"id"`
 	Name     *Name  `gorm:"embedded;embeddedPrefix:name_" json:"name" binding:"required"`
 	Username string `gorm:"unique;not null" json:"username" binding:"required"`
 	Email    string `gorm:"unique;not null" json:"email" binding:"required,email"`
-	Role     string `gorm:"type:varchar(20);default:'user'" json:"role"`
-	Password string `json:"password" binding:"required,min=6"`
+	Role     string `gorm:"type:varchar(20);default:'user'" json:"role"` // Primary role, carried in tokens
+	Password string `json:"password" binding:"required,max=72"`          // Length and strength rules live in utils.PasswordPolicy
+
+	// Email verification state; only set by the verification flow, never from request bodies
+	EmailVerified   bool       `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// TOTP two-factor authentication. The secret is stored while enrollment is
+	// pending and only takes effect once TOTPEnabled is set by the confirmation step.
+	TOTPSecret   string `gorm:"size:64" json:"-"`
+	TOTPEnabled  bool   `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `json:"-"` // Last accepted time step, to reject replayed codes
+
+	// Account status; only changed through the status endpoints, never from request bodies.
+	// A suspension with SuspendedUntil set lifts itself once that moment has passed.
+	Status          string     `gorm:"type:varchar(20);not null;default:'active'" json:"status"`
+	StatusReason    string     `gorm:"size:500" json:"status_reason,omitempty"`
+	SuspendedUntil  *time.Time `json:"suspended_until,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+
+	// Tokens issued before this moment are rejected ("log out everywhere")
+	TokensValidAfter *time.Time `json:"-"`
+
+	// Additional roles; permissions are the union of these and the primary role.
+	// Only assigned through the admin role endpoints, never from request bodies.
+	Roles []Role `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;" json:"roles,omitempty"`
 
 	// One-to-Many relationship with Book
 	Books []Book `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"books"`
+
+	// Refresh tokens issued to this user; removed together with the account
+	RefreshTokens []RefreshToken `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Outstanding password reset tokens
+	PasswordResetTokens []PasswordResetToken `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Two-factor recovery codes
+	RecoveryCodes []RecoveryCode `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Personal API keys for machine clients
+	APIKeys []APIKey `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// OAuth2 clients registered by this user, and codes granted by them
+	OAuthClients       []OAuthClient            `gorm:"foreignKey:OwnerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	AuthorizationCodes []OAuthAuthorizationCode `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Organizations the user belongs to
+	Memberships []OrganizationMembership `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Accounts at external OpenID Connect providers used to sign in
+	Identities []UserIdentity `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// EffectiveStatus returns the account status at the given moment, treating an
+// expired suspension as active
+func (u *User) EffectiveStatus(now time.Time) string {
+	if u.Status == UserStatusSuspended && u.SuspendedUntil != nil && !now.Before(*u.SuspendedUntil) {
+		return UserStatusActive
+	}
+	if u.Status == "" {
+		return UserStatusActive
+	}
+	return u.Status
 }
@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "test-client"
+	testKeyID    = "test-key"
+	testNonce    = "test-nonce"
+)
+
+// testIdP is a stand-in OpenID Connect provider serving discovery, keys and a
+// token endpoint that hands out whatever ID token the test put in idToken
+type testIdP struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, Discovery{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+			IDTokenSigningAlgs:    []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idp.idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/auth/oidc/callback",
+	}, idp.server.Client())
+}
+
+// claims returns valid ID token claims for the test client
+func (idp *testIdP) claims() *IDTokenClaims {
+	now := time.Now()
+	return &IDTokenClaims{
+		Nonce:         testNonce,
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "alice",
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+}
+
+func (idp *testIdP) sign(t *testing.T, claims *IDTokenClaims, key *rsa.PrivateKey) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign ID token: %v", err)
+	}
+	return signed
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestExchangeReturnsVerifiedClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.idToken = idp.sign(t, idp.claims(), idp.key)
+
+	claims, err := idp.provider().Exchange(context.Background(), "code", "verifier", testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*IDTokenClaims)
+		key    *rsa.PrivateKey
+		nonce  string
+	}{
+		{name: "signed with another key", key: otherKey, nonce: testNonce},
+		{name: "nonce mismatch", nonce: "other-nonce"},
+		{name: "nonce missing from request", nonce: ""},
+		{name: "wrong audience", nonce: testNonce, modify: func(c *IDTokenClaims) {
+			c.Audience = jwt.ClaimStrings{"another-client"}
+		}},
+		{name: "expired", nonce: testNonce, modify: func(c *IDTokenClaims) {
+			c.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Minute))
+		}},
+		{name: "without expiry", nonce: testNonce, modify: func(c *IDTokenClaims) {
+			c.ExpiresAt = nil
+		}},
+		{name: "wrong issuer", nonce: testNonce, modify: func(c *IDTokenClaims) {
+			c.Issuer = "https://evil.example.com"
+		}},
+		{name: "azp of another client", nonce: testNonce, modify: func(c *IDTokenClaims) {
+			c.Audience = jwt.ClaimStrings{testClientID, "another-client"}
+			c.AuthorizedParty = "another-client"
+		}},
+	}
+
+	provider := idp.provider()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = idp.key
+			}
+
+			_, err := provider.VerifyIDToken(context.Background(), idp.sign(t, claims, key), tt.nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsUnlistedAlgorithm(t *testing.T) {
+	idp := newTestIdP(t)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.claims())
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString([]byte("shared-secret"))
+	if err != nil {
+		t.Fatalf("sign ID token: %v", err)
+	}
+
+	if _, err := idp.provider().VerifyIDToken(context.Background(), signed, testNonce); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+	}
+}
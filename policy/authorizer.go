@@ -0,0 +1,33 @@
+package policy
+
+import "errors"
+
+// ErrForbidden is returned by an Authorizer when the actor may not perform the action
+var ErrForbidden = errors.New("forbidden")
+
+// Actor is the authenticated caller an authorization decision is made for
+type Actor struct {
+	UserID uint
+	Role   string
+	// Permissions granted through the actor's roles. Empty when the session does
+	// not satisfy the two-factor requirement of the actor's role.
+	Permissions map[string]bool
+	// ImpersonatorID is the admin acting as UserID, or 0 when not impersonating
+	ImpersonatorID uint
+	// OrgID is the organization the request is confined to and OrgRole the
+	// actor's role in it; 0 and "" outside any organization
+	OrgID   uint
+	OrgRole string
+}
+
+// Can reports whether the actor holds the permission
+func (a Actor) Can(permission string) bool {
+	return a.Permissions[permission]
+}
+
+// Authorizer decides whether an actor may perform an action on a resource.
+// Controllers consult one before calling into services; it returns nil when the
+// action is allowed and ErrForbidden otherwise.
+type Authorizer interface {
+	Authorize(actor Actor, action string, resource interface{}) error
+}
@@ -0,0 +1,48 @@
+package policy
+
+import (
+	"fmt"
+	"gocheck/models"
+)
+
+// Actions understood by UserPolicy
+const (
+	// ActionUpdateUser edits a user's profile (name, username, email)
+	ActionUpdateUser = "user.update"
+	// ActionChangeUserRole changes a user's primary role
+	ActionChangeUserRole = "user.change_role"
+	// ActionChangeUserStatus suspends, deactivates or reactivates another user's account
+	ActionChangeUserStatus = "user.change_status"
+)
+
+// UserPolicy authorizes actions on user accounts: users may edit themselves,
+// holders of users:update may edit anyone, and only holders of roles:manage may
+// change a role, including their own. Holders of users:update may change the status
+// of other accounts, but only holders of roles:manage may disable an admin.
+type UserPolicy struct{}
+
+// Authorize implements Authorizer for *models.User resources
+func (UserPolicy) Authorize(actor Actor, action string, resource interface{}) error {
+	target, ok := resource.(*models.User)
+	if !ok {
+		return fmt.Errorf("user policy: unsupported resource %T", resource)
+	}
+
+	switch action {
+	case ActionUpdateUser:
+		if actor.UserID == target.ID || actor.Can("users:update") {
+			return nil
+		}
+	case ActionChangeUserRole:
+		if actor.Can("roles:manage") {
+			return nil
+		}
+	case ActionChangeUserStatus:
+		if actor.UserID != target.ID && actor.Can("users:update") && (target.Role != "admin" || actor.Can("roles:manage")) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("user policy: unknown action %q", action)
+	}
+	return ErrForbidden
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterAPIKeyRoutes(router *gin.Engine, db *gorm.DB) {
+	apiKeyController := controllers.NewAPIKeyController(db)
+
+	// Personal API keys of the authenticated user
+	apiKeyRoutes := router.Group("/api-keys", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"))
+	{
+		apiKeyRoutes.POST("", apiKeyController.CreateAPIKey)
+		apiKeyRoutes.GET("", apiKeyController.ListAPIKeys)
+		apiKeyRoutes.DELETE("/:id", apiKeyController.RevokeAPIKey)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterAuditRoutes(router *gin.Engine, db *gorm.DB) {
+	auditController := controllers.NewAuditController(db)
+
+	auditRoutes := router.Group("/admin/audit-events",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "security:manage"),
+	)
+	{
+		auditRoutes.GET("", auditController.ListAuditEvents)
+		auditRoutes.GET("/verify", auditController.VerifyAuditChain)
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"gocheck/controllers"
+	"gocheck/middleware"
 
 	"gorm.io/gorm"
 
@@ -11,12 +12,13 @@ import (
 func RegisterBookRoutes(r *gin.Engine, db *gorm.DB) {
 	bookController := controllers.NewBookController(db)
 
-	bookRoutes := r.Group("/books")
+	// Books belong to the authenticated caller; ownership is checked per book
+	bookRoutes := r.Group("/books", middleware.AuthMiddleware(db))
 	{
-		bookRoutes.POST("/", bookController.CreateBook)      // Create a new book
-		bookRoutes.GET("/", bookController.GetAllBooks)      // Get all books
-		bookRoutes.GET("/:id", bookController.GetBookByID)   // Get a book by ID
-		bookRoutes.PUT("/:id", bookController.UpdateBook)    // Update a book by ID
-		bookRoutes.DELETE("/:id", bookController.DeleteBook) // Delete a book by ID
+		bookRoutes.POST("/", middleware.RequireScope("books:write"), bookController.CreateBook)      // Create a new book
+		bookRoutes.GET("/", middleware.RequireScope("books:read"), bookController.GetAllBooks)       // Get all books
+		bookRoutes.GET("/:id", middleware.RequireScope("books:read"), bookController.GetBookByID)    // Get a book by ID
+		bookRoutes.PUT("/:id", middleware.RequireScope("books:write"), bookController.UpdateBook)    // Update a book by ID
+		bookRoutes.DELETE("/:id", middleware.RequireScope("books:write"), bookController.DeleteBook) // Delete a book by ID
 	}
 }
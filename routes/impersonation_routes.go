@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterImpersonationRoutes(router *gin.Engine, db *gorm.DB) {
+	impersonationController := controllers.NewImpersonationController(db)
+
+	router.POST("/admin/impersonate/:id",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RoleAuthorization("admin"),
+		impersonationController.Impersonate,
+	)
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterInvitationRoutes(router *gin.Engine, db *gorm.DB) {
+	invitationController := controllers.NewInvitationController(db)
+
+	adminRoutes := router.Group("/admin/invitations",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "users:invite"),
+	)
+	{
+		adminRoutes.POST("", invitationController.CreateSignupInvitation)
+		adminRoutes.GET("", invitationController.ListSignupInvitations)
+		adminRoutes.DELETE("/:id", invitationController.RevokeSignupInvitation)
+	}
+
+	// Anonymous callers register with the invitation, signed-in users join its organization
+	router.POST("/invitations/:token/accept",
+		middleware.OptionalAuthMiddleware(db),
+		middleware.DenyImpersonation(),
+		middleware.RequireScope("users:write"),
+		invitationController.AcceptInvitation,
+	)
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"gocheck/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterKeyRoutes(router *gin.Engine) {
+	keyController := controllers.NewKeyController()
+
+	router.GET("/.well-known/jwks.json", keyController.JWKS) // Public verification keys
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterMeRoutes(router *gin.Engine, db *gorm.DB) {
+	meController := controllers.NewMeController(db)
+	sessionController := controllers.NewSessionController(db)
+
+	// Everything here acts on the authenticated user, taken from the token
+	meRoutes := router.Group("/me", middleware.AuthMiddleware(db))
+	{
+		meRoutes.GET("", middleware.RequireScope("users:read"), meController.GetProfile)
+		meRoutes.PATCH("", middleware.RequireScope("users:write"), meController.UpdateProfile)
+		meRoutes.DELETE("", middleware.DenyImpersonation(), middleware.RequireScope("users:write"), meController.DeleteProfile)
+		meRoutes.GET("/books", middleware.RequireScope("books:read"), meController.GetMyBooks)
+		meRoutes.GET("/sessions", middleware.RequireScope("users:read"), sessionController.ListSessions)
+		meRoutes.DELETE("/sessions/:id", middleware.DenyImpersonation(), middleware.RequireScope("users:write"), sessionController.RevokeSession)
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterOAuthRoutes(router *gin.Engine, db *gorm.DB) {
+	oauthController := controllers.NewOAuthController(db)
+
+	// Client-facing endpoints authenticate the client, not a user
+	router.POST("/oauth/token", oauthController.Token)
+	router.POST("/oauth/introspect", oauthController.Introspect)
+	router.POST("/oauth/revoke", oauthController.Revoke)
+
+	// User-facing endpoints: consent and client registration
+	userRoutes := router.Group("/oauth", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"))
+	{
+		userRoutes.GET("/authorize", oauthController.Authorize)
+		userRoutes.POST("/authorize", oauthController.Consent)
+		userRoutes.POST("/clients", oauthController.RegisterClient)
+		userRoutes.GET("/clients", oauthController.ListClients)
+		userRoutes.DELETE("/clients/:id", oauthController.RevokeClient)
+	}
+}
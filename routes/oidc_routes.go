@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"gocheck/config"
+	"gocheck/controllers"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterOIDCRoutes(router *gin.Engine, db *gorm.DB) {
+	// Only offered when an identity provider is configured
+	if config.AppConfig.OIDC.Issuer == "" {
+		return
+	}
+	oidcController := controllers.NewOIDCController(db)
+
+	router.GET("/auth/oidc/login", oidcController.Login)       // Redirect to the identity provider
+	router.GET("/auth/oidc/callback", oidcController.Callback) // Return from the identity provider
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterOrganizationRoutes(router *gin.Engine, db *gorm.DB) {
+	organizationController := controllers.NewOrganizationController(db)
+
+	adminRoutes := router.Group("/admin/organizations",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+	)
+	{
+		adminRoutes.POST("", middleware.RequirePermission(db, "orgs:manage"), organizationController.CreateOrganization)
+		adminRoutes.GET("", middleware.RequirePermission(db, "orgs:manage"), organizationController.ListOrganizations)
+		adminRoutes.GET("/:id", middleware.RequirePermission(db, "orgs:manage"), organizationController.GetOrganization)
+		adminRoutes.PUT("/:id", middleware.RequirePermission(db, "orgs:manage"), organizationController.UpdateOrganization)
+		adminRoutes.DELETE("/:id", middleware.RequirePermission(db, "orgs:manage"), organizationController.DeleteOrganization)
+
+		// Members and invitations are also open to owners and admins of the organization;
+		// the controller checks the organization policy
+		adminRoutes.GET("/:id/members", organizationController.ListMembers)
+		adminRoutes.PUT("/:id/members/:userId", organizationController.SetMemberRole)
+		adminRoutes.DELETE("/:id/members/:userId", organizationController.RemoveMember)
+		adminRoutes.POST("/:id/invitations", organizationController.CreateInvitation)
+		adminRoutes.GET("/:id/invitations", organizationController.ListInvitations)
+		adminRoutes.DELETE("/:id/invitations/:invitationId", organizationController.RevokeInvitation)
+	}
+
+	orgRoutes := router.Group("/orgs", middleware.AuthMiddleware(db))
+	{
+		orgRoutes.GET("", middleware.RequireScope("users:read"), organizationController.ListMyOrganizations)
+		orgRoutes.POST("/:id/switch", middleware.DenyImpersonation(), organizationController.SwitchOrganization)
+	}
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"gocheck/controllers"
+	"gocheck/middleware"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterRoleRoutes(router *gin.Engine, db *gorm.DB) {
+	roleController := controllers.NewRoleController(db)
+
+	// Every role endpoint requires the roles:manage permission
+	adminRoutes := router.Group("/admin",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "roles:manage"),
+	)
+	{
+		adminRoutes.GET("/roles", roleController.ListRoles)
+		adminRoutes.POST("/roles", roleController.CreateRole)
+		adminRoutes.GET("/roles/:id", roleController.GetRoleByID)
+		adminRoutes.PUT("/roles/:id", roleController.UpdateRole)
+		adminRoutes.DELETE("/roles/:id", roleController.DeleteRole)
+		adminRoutes.GET("/permissions", roleController.ListPermissions)
+		adminRoutes.PUT("/users/:id/roles", roleController.SetUserRoles)
+	}
+}
@@ -10,20 +10,56 @@ import (
 
 func SetupUserRoutes(router *gin.Engine, db *gorm.DB) {
 	userController := controllers.NewUserController(db)
+	passwordController := controllers.NewPasswordController(db)
+	mfaController := controllers.NewMFAController(db)
 
 	// Public endpoints (Swagger will pick these up)
-	router.POST("/users", userController.CreateUser)     // Register user
-	router.POST("/login", userController.Login)          // Login
-	router.GET("/users/:id", userController.GetUserByID) // Get user by ID
-	router.GET("/users", userController.GetAllUsers)     // Get all users
+	router.POST("/users", userController.CreateUser)                       // Register user
+	router.POST("/login", userController.Login)                            // Login
+	router.POST("/login/mfa", mfaController.LoginMFA)                      // Second login step for TOTP users
+	router.POST("/token/refresh", userController.RefreshToken)             // Rotate refresh token
+	router.POST("/password/forgot", passwordController.ForgotPassword)     // Email a reset link
+	router.POST("/password/reset", passwordController.ResetPassword)       // Consume a reset link
+	router.GET("/users/verify", userController.VerifyEmail)                // Confirm email address
+	router.POST("/users/verify/resend", userController.ResendVerification) // Resend verification link
 
 	// Protected routes (also visible to Swagger)
-	router.PUT("/users/:id", middleware.AuthMiddleware(), userController.UpdateUser)
+	router.GET("/users/:id", middleware.AuthMiddleware(db), middleware.RequireScope("users:read"), userController.GetUserByID) // Get user by ID
+	router.GET("/users", middleware.AuthMiddleware(db), middleware.RequireScope("users:read"), userController.GetAllUsers)     // Get all users
+	router.PUT("/users/:id", middleware.AuthMiddleware(db), middleware.RequireScope("users:write"), userController.UpdateUser)
+	router.PUT("/users/:id/password", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"), userController.ChangePassword)
+	router.POST("/users/:id/deactivate", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"), userController.DeactivateAccount)
+	router.POST("/logout", middleware.AuthMiddleware(db), userController.Logout)
+	router.POST("/logout/all", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), userController.LogoutAll)
+	router.POST("/mfa/totp/enroll", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"), mfaController.Enroll)
+	router.POST("/mfa/totp/confirm", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"), mfaController.Confirm)
+	router.DELETE("/mfa/totp", middleware.AuthMiddleware(db), middleware.DenyImpersonation(), middleware.RequireScope("users:write"), mfaController.Disable)
 
-	// Admin-only route
+	// Admin-only routes
 	router.DELETE("/users/admin/:id",
-		middleware.AuthMiddleware(),
-		middleware.RoleAuthorization("admin"),
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "users:delete"),
 		userController.DeleteUser,
 	)
+
+	router.PUT("/admin/users/:id/status",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "users:update"),
+		userController.SetUserStatus,
+	)
+
+	router.GET("/admin/lockouts",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "security:manage"),
+		userController.ListLockouts,
+	)
+	router.DELETE("/admin/lockouts",
+		middleware.AuthMiddleware(db),
+		middleware.RequireScope("users:admin"),
+		middleware.RequirePermission(db, "security:manage"),
+		userController.ClearLockout,
+	)
 }
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"gocheck/models"
+	"gocheck/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAPIKey is returned for malformed, unknown, expired or revoked API keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+const (
+	apiKeyPrefix = "gk"
+	// lastUsedResolution limits how often last_used_at is written for a busy key
+	lastUsedResolution = time.Minute
+)
+
+// APIKeyService manages personal API keys
+type APIKeyService struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyService creates a new APIKeyService
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// CreateKey issues a new key for the user, confined to orgID like the session
+// that created it. The returned raw key is shown to the caller once and cannot
+// be recovered later.
+func (s *APIKeyService) CreateKey(userID, orgID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	scopes, err := utils.NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	prefixBytes, err := utils.GenerateRandomToken(6)
+	if err != nil {
+		return nil, "", err
+	}
+	// The prefix is split on "_", so keep it free of that character
+	prefix := strings.ReplaceAll(prefixBytes, "_", "x")
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := models.APIKey{
+		UserID:     userID,
+		Name:       name,
+		Prefix:     prefix,
+		SecretHash: utils.HashToken(secret),
+		Scopes:     utils.FormatScope(scopes),
+		OrgID:      orgID,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, fmt.Sprintf("%s_%s_%s", apiKeyPrefix, prefix, secret), nil
+}
+
+// ListKeys returns the user's keys, newest first
+func (s *APIKeyService) ListKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeKey revokes one of the user's keys. Keys of other users are reported as not found.
+func (s *APIKeyService) RevokeKey(userID, id uint) error {
+	result := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves a raw key to the key record and its owner
+func (s *APIKeyService) Authenticate(rawKey string) (*models.APIKey, *models.User, error) {
+	parts := strings.SplitN(rawKey, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("prefix = ?", parts[1]).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(parts[2])), []byte(key.SecretHash)) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := s.db.First(&user, key.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+	if err := CheckAccountStatus(&user); err != nil {
+		return nil, nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		if err := s.db.Model(&key).Update("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	return &key, &user, nil
+}
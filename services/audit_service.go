@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"gocheck/models"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// auditChainLockKey is the Postgres advisory lock that serializes hash chain writers
+const auditChainLockKey = 0x61756469 // "audi"
+
+// Maximum number of events returned by a single query
+const maxAuditQueryLimit = 200
+
+// redactedAuditFields are reported as changed without revealing their values
+var redactedAuditFields = map[string]bool{"password": true}
+
+// AuditActor identifies who performs a mutation and from where. The zero value
+// stands for the system or an anonymous caller.
+type AuditActor struct {
+	UserID         uint
+	ImpersonatorID *uint
+	IP             string
+	UserAgent      string
+	RequestID      string
+}
+
+// AuditFilter narrows QueryEvents; zero fields are ignored
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditChainStatus is the result of verifying the hash chain
+type AuditChainStatus struct {
+	Valid    bool   `json:"valid"`
+	Checked  int64  `json:"checked"`
+	BrokenAt *uint  `json:"broken_at,omitempty"` // First event whose hash or link does not match
+	Reason   string `json:"reason,omitempty"`
+}
+
+// AuditService writes and queries the audit trail
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService creates a new AuditService
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record appends an event to the audit trail
+func (s *AuditService) Record(event *models.AuditEvent) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return appendAuditEvent(tx, event)
+	})
+}
+
+// QueryEvents returns matching events, newest first, and the total number of matches
+func (s *AuditService) QueryEvents(filter AuditFilter) ([]models.AuditEvent, int64, error) {
+	query := s.db.Model(&models.AuditEvent{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ? OR impersonator_id = ?", *filter.ActorID, *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditQueryLimit {
+		limit = maxAuditQueryLimit
+	}
+	var events []models.AuditEvent
+	if err := query.Order("id DESC").Limit(limit).Offset(filter.Offset).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// VerifyChain walks every chained event in order and checks that each one links
+// to its predecessor and still matches its own hash
+func (s *AuditService) VerifyChain() (*AuditChainStatus, error) {
+	status := &AuditChainStatus{Valid: true}
+	prevHash := ""
+	var events []models.AuditEvent
+	err := s.db.Where("hash <> ''").Order("id").FindInBatches(&events, 500, func(tx *gorm.DB, batch int) error {
+		for i := range events {
+			event := &events[i]
+			status.Checked++
+			switch {
+			case status.Checked > 1 && event.PrevHash != prevHash:
+				status.Reason = "previous event is missing or was altered"
+			case auditHash(event) != event.Hash:
+				status.Reason = "event content does not match its hash"
+			default:
+				prevHash = event.Hash
+				continue
+			}
+			status.Valid = false
+			status.BrokenAt = &event.ID
+			return errStopVerification
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errStopVerification) {
+		return nil, err
+	}
+	return status, nil
+}
+
+// errStopVerification ends VerifyChain at the first broken link
+var errStopVerification = errors.New("audit chain broken")
+
+// recordChange writes the audit event for a data-changing action inside the
+// mutation's transaction, so the change and its record commit or fail together.
+// before and after are snapshots taken with auditSnapshot; nil for creations and deletions.
+func recordChange(tx *gorm.DB, actor *AuditActor, action, targetType string, targetID uint, before, after map[string]interface{}) error {
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   strconv.FormatUint(uint64(targetID), 10),
+		Outcome:    models.AuditOutcomeAllowed,
+		Changes:    auditDiff(before, after),
+	}
+	if actor != nil {
+		event.ActorID = actor.UserID
+		event.ImpersonatorID = actor.ImpersonatorID
+		event.IP = actor.IP
+		event.UserAgent = actor.UserAgent
+		event.RequestID = actor.RequestID
+	}
+	return appendAuditEvent(tx, event)
+}
+
+// appendAuditEvent inserts an event, linking it into the hash chain when enabled.
+// tx must be a transaction so the chain lock is held until commit.
+func appendAuditEvent(tx *gorm.DB, event *models.AuditEvent) error {
+	if !config.AppConfig.AuditHashChain {
+		return tx.Create(event).Error
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error; err != nil {
+		return err
+	}
+	var last models.AuditEvent
+	if err := tx.Select("hash").Where("hash <> ''").Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	event.PrevHash = last.Hash
+	// Postgres keeps microseconds, so hash exactly what will be read back
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.Hash = auditHash(event)
+	return tx.Create(event).Error
+}
+
+// auditHash commits to the previous hash and every recorded field of the event
+func auditHash(event *models.AuditEvent) string {
+	changes := ""
+	if len(event.Changes) > 0 {
+		b, _ := json.Marshal(event.Changes) // map keys are sorted, so this is stable
+		changes = string(b)
+	}
+	impersonator := ""
+	if event.ImpersonatorID != nil {
+		impersonator = strconv.FormatUint(uint64(*event.ImpersonatorID), 10)
+	}
+	fields := []string{
+		event.PrevHash,
+		strconv.FormatUint(uint64(event.ActorID), 10),
+		impersonator,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Outcome,
+		event.Detail,
+		changes,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+	h := sha256.New()
+	for _, field := range fields {
+		// Length-prefix each field so values cannot shift between fields
+		fmt.Fprintf(h, "%d:%s|", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditSnapshot captures the JSON representation of a record for diffing
+func auditSnapshot(v interface{}) map[string]interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// auditDiff returns the fields that differ between two snapshots. Redacted
+// fields are reported as changed with their values hidden.
+func auditDiff(before, after map[string]interface{}) models.AuditChanges {
+	changes := models.AuditChanges{}
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	for k := range keys {
+		oldValue, hadOld := before[k]
+		newValue, hasNew := after[k]
+		if hadOld && hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if redactedAuditFields[strings.ToLower(k)] {
+			change := models.AuditChange{}
+			if hadOld {
+				change.Before = "[redacted]"
+			}
+			if hasNew {
+				change.After = "[redacted]"
+			}
+			changes[k] = change
+			continue
+		}
+		changes[k] = models.AuditChange{Before: oldValue, After: newValue}
+	}
+	return changes
+}
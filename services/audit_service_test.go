@@ -0,0 +1,179 @@
+package services
+
+import (
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/testdb"
+	"testing"
+	"time"
+)
+
+func testAuditEvent() *models.AuditEvent {
+	impersonator := uint(9)
+	return &models.AuditEvent{
+		ActorID:        1,
+		ImpersonatorID: &impersonator,
+		Action:         "user.update",
+		TargetType:     "user",
+		TargetID:       "2",
+		Outcome:        models.AuditOutcomeAllowed,
+		Detail:         "detail",
+		Changes:        models.AuditChanges{"email": {Before: "a@example.com", After: "b@example.com"}},
+		IP:             "10.0.0.1",
+		UserAgent:      "test",
+		RequestID:      "req-1",
+		CreatedAt:      time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+		PrevHash:       "previous",
+	}
+}
+
+func TestAuditHashCoversEveryField(t *testing.T) {
+	base := auditHash(testAuditEvent())
+	if base != auditHash(testAuditEvent()) {
+		t.Fatal("auditHash is not deterministic")
+	}
+
+	other := uint(10)
+	tampers := map[string]func(*models.AuditEvent){
+		"prev hash":    func(e *models.AuditEvent) { e.PrevHash = "other" },
+		"actor":        func(e *models.AuditEvent) { e.ActorID = 3 },
+		"impersonator": func(e *models.AuditEvent) { e.ImpersonatorID = &other },
+		"no impersonator": func(e *models.AuditEvent) {
+			e.ImpersonatorID = nil
+		},
+		"action":      func(e *models.AuditEvent) { e.Action = "user.delete" },
+		"target type": func(e *models.AuditEvent) { e.TargetType = "book" },
+		"target id":   func(e *models.AuditEvent) { e.TargetID = "3" },
+		"outcome":     func(e *models.AuditEvent) { e.Outcome = models.AuditOutcomeDenied },
+		"detail":      func(e *models.AuditEvent) { e.Detail = "other" },
+		"changes": func(e *models.AuditEvent) {
+			e.Changes = models.AuditChanges{"email": {Before: "a@example.com", After: "c@example.com"}}
+		},
+		"ip":         func(e *models.AuditEvent) { e.IP = "10.0.0.2" },
+		"user agent": func(e *models.AuditEvent) { e.UserAgent = "other" },
+		"request id": func(e *models.AuditEvent) { e.RequestID = "req-2" },
+		"created at": func(e *models.AuditEvent) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+	}
+	for name, tamper := range tampers {
+		event := testAuditEvent()
+		tamper(event)
+		if auditHash(event) == base {
+			t.Errorf("changing the %s does not change the hash", name)
+		}
+	}
+}
+
+func TestAuditHashSeparatesFields(t *testing.T) {
+	a := testAuditEvent()
+	a.TargetType, a.TargetID = "user", "12"
+	b := testAuditEvent()
+	b.TargetType, b.TargetID = "user1", "2"
+	if auditHash(a) == auditHash(b) {
+		t.Error("moving characters between fields keeps the hash")
+	}
+}
+
+func TestAuditDiffRedactsPasswords(t *testing.T) {
+	changes := auditDiff(
+		map[string]interface{}{"username": "alice", "password": "old-hash", "email": "a@example.com"},
+		map[string]interface{}{"username": "alice", "password": "new-hash", "email": "b@example.com"},
+	)
+	if _, ok := changes["username"]; ok {
+		t.Error("unchanged field reported as changed")
+	}
+	if got := changes["email"]; got.Before != "a@example.com" || got.After != "b@example.com" {
+		t.Errorf("email change = %+v", got)
+	}
+	if got := changes["password"]; got.Before != "[redacted]" || got.After != "[redacted]" {
+		t.Errorf("password change = %+v, want redacted values", got)
+	}
+}
+
+// withAuditHashChain turns on the hash chain for the duration of a test
+func withAuditHashChain(t *testing.T) {
+	t.Helper()
+	saved := config.AppConfig.AuditHashChain
+	config.AppConfig.AuditHashChain = true
+	t.Cleanup(func() { config.AppConfig.AuditHashChain = saved })
+}
+
+// recordTestEvents appends n chained events and returns them in order
+func recordTestEvents(t *testing.T, audit *AuditService, n int) []*models.AuditEvent {
+	t.Helper()
+	events := make([]*models.AuditEvent, n)
+	for i := range events {
+		events[i] = &models.AuditEvent{Action: "test.event", TargetType: "test", TargetID: "1", Outcome: models.AuditOutcomeAllowed}
+		if err := audit.Record(events[i]); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	return events
+}
+
+func TestVerifyChainAcceptsIntactChain(t *testing.T) {
+	withAuditHashChain(t)
+	db := testdb.Open(t)
+	audit := NewAuditService(db)
+
+	events := recordTestEvents(t, audit, 3)
+	for i := 1; i < len(events); i++ {
+		if events[i].PrevHash != events[i-1].Hash {
+			t.Errorf("event %d does not link to its predecessor", i)
+		}
+	}
+
+	status, err := audit.VerifyChain()
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if !status.Valid || status.Checked < 3 {
+		t.Errorf("VerifyChain = %+v, want a valid chain of at least 3 events", status)
+	}
+}
+
+func TestVerifyChainDetectsTampering(t *testing.T) {
+	withAuditHashChain(t)
+	db := testdb.Open(t)
+	audit := NewAuditService(db)
+
+	if status, err := audit.VerifyChain(); err != nil || !status.Valid {
+		t.Fatalf("audit chain is broken before the test: %+v, %v", status, err)
+	}
+	events := recordTestEvents(t, audit, 3)
+
+	// Raw SQL gets past the append-only hooks, as an attacker with database access would
+	if err := db.Exec("UPDATE audit_events SET detail = ? WHERE id = ?", "edited", events[1].ID).Error; err != nil {
+		t.Fatalf("tamper with event: %v", err)
+	}
+
+	status, err := audit.VerifyChain()
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if status.Valid || status.BrokenAt == nil || *status.BrokenAt != events[1].ID {
+		t.Errorf("VerifyChain = %+v, want broken at event %d", status, events[1].ID)
+	}
+}
+
+func TestVerifyChainDetectsDeletion(t *testing.T) {
+	withAuditHashChain(t)
+	db := testdb.Open(t)
+	audit := NewAuditService(db)
+
+	if status, err := audit.VerifyChain(); err != nil || !status.Valid {
+		t.Fatalf("audit chain is broken before the test: %+v, %v", status, err)
+	}
+	events := recordTestEvents(t, audit, 3)
+
+	if err := db.Exec("DELETE FROM audit_events WHERE id = ?", events[1].ID).Error; err != nil {
+		t.Fatalf("delete event: %v", err)
+	}
+
+	status, err := audit.VerifyChain()
+	if err != nil {
+		t.Fatalf("VerifyChain: %v", err)
+	}
+	if status.Valid || status.BrokenAt == nil || *status.BrokenAt != events[2].ID {
+		t.Errorf("VerifyChain = %+v, want broken at event %d", status, events[2].ID)
+	}
+}
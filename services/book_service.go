@@ -6,18 +6,53 @@ import (
 	"gorm.io/gorm"
 )
 
+// BookService provides business logic for books. Mutations are audited in the
+// same transaction, attributed to the actor set with WithActor, and queries are
+// confined to the organization set with WithTenant.
 type BookService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	actor  *AuditActor
+	tenant *uint
 }
 
 func NewBookService(db *gorm.DB) *BookService {
 	return &BookService{db: db}
 }
 
+// WithActor returns a copy of the service whose mutations are audited as actor
+func (s *BookService) WithActor(actor AuditActor) *BookService {
+	scoped := *s
+	scoped.actor = &actor
+	return &scoped
+}
+
+// WithTenant returns a copy of the service that only sees and creates books of orgID
+func (s *BookService) WithTenant(orgID uint) *BookService {
+	scoped := *s
+	scoped.tenant = &orgID
+	return &scoped
+}
+
+// scope applies the tenant restriction, if any, to a query
+func (s *BookService) scope(db *gorm.DB) *gorm.DB {
+	if s.tenant == nil {
+		return db
+	}
+	return bookTenantScope(*s.tenant)(db)
+}
+
 // CreateBook adds a new book to the database
 
 func (s *BookService) CreateBook(book *models.Book) (*models.Book, error) {
-	err := s.db.Create(book).Error
+	if s.tenant != nil {
+		book.OrgID = *s.tenant
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(book).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, s.actor, "book.create", "book", book.ID, nil, auditSnapshot(book))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +62,7 @@ func (s *BookService) CreateBook(book *models.Book) (*models.Book, error) {
 // GetBooksByUserID returns all books for a specific user
 func (s *BookService) GetBooksByUserID(userID uint) ([]models.Book, error) {
 	var books []models.Book
-	if err := s.db.Where("user_id = ?", userID).Find(&books).Error; err != nil {
+	if err := s.db.Scopes(s.scope).Where("user_id = ?", userID).Find(&books).Error; err != nil {
 		return nil, err
 	}
 	return books, nil
@@ -36,14 +71,24 @@ func (s *BookService) GetBooksByUserID(userID uint) ([]models.Book, error) {
 // GetBookByID gets a single book
 func (s *BookService) GetBookByID(id uint) (*models.Book, error) {
 	var book models.Book
-	if err := s.db.First(&book, id).Error; err != nil {
+	if err := s.db.Scopes(s.scope).First(&book, id).Error; err != nil {
 		return nil, err
 	}
 	return &book, nil
 }
 
 func (bs *BookService) UpdateBook(book *models.Book) (*models.Book, error) {
-	err := bs.db.Save(book).Error
+	err := bs.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Book
+		if err := tx.Scopes(bs.scope).First(&existing, book.ID).Error; err != nil {
+			return err
+		}
+		book.OrgID = existing.OrgID // Books never move between tenants
+		if err := tx.Save(book).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, bs.actor, "book.update", "book", book.ID, auditSnapshot(&existing), auditSnapshot(book))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -52,14 +97,20 @@ func (bs *BookService) UpdateBook(book *models.Book) (*models.Book, error) {
 
 // DeleteBook deletes a single book
 func (s *BookService) DeleteBook(id uint) error {
-	if err := s.db.Delete(&models.Book{}, id).Error; err != nil {
-		return err
-	}
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var book models.Book
+		if err := tx.Scopes(s.scope).First(&book, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&book).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, s.actor, "book.delete", "book", id, auditSnapshot(&book), nil)
+	})
 }
 func (bs *BookService) GetAllBooks() ([]models.Book, error) {
 	var books []models.Book
-	err := bs.db.Find(&books).Error
+	err := bs.db.Scopes(bs.scope).Find(&books).Error
 	if err != nil {
 		return nil, err
 	}
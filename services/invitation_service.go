@@ -0,0 +1,343 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"gocheck/mailer"
+	"gocheck/models"
+	"gocheck/utils"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidInvitation is returned for unknown, expired, revoked or already used invitations
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+	// ErrInvitationEmailMismatch is returned when an invitation is accepted by a user with another email address
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email address")
+	// ErrInvitationNeedsRegistration is returned when a signed-in user accepts a sign-up invitation
+	ErrInvitationNeedsRegistration = errors.New("invitation is for registering a new account")
+	// ErrInvitationEmailRegistered is returned when registering with an invitation whose email already has an account
+	ErrInvitationEmailRegistered = errors.New("an account with this email address already exists")
+	// ErrInvalidInvitationExpiry is returned for an expiry that is not in the future
+	ErrInvalidInvitationExpiry = errors.New("invitation expiry must be in the future")
+)
+
+// defaultInvitationTTL is used when the configuration does not provide a lifetime
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+// InvitationService issues and redeems invitations. Organization invitations
+// add the invitee to an organization; sign-up invitations, which have no
+// organization, are how new users register when open registration is off.
+// Registrations are audited as the actor set with WithActor.
+type InvitationService struct {
+	db     *gorm.DB
+	mailer mailer.Mailer
+	actor  *AuditActor
+}
+
+// NewInvitationService creates a new InvitationService
+func NewInvitationService(db *gorm.DB, m mailer.Mailer) *InvitationService {
+	return &InvitationService{db: db, mailer: m}
+}
+
+// WithActor returns a copy of the service whose registrations are audited as actor
+func (s *InvitationService) WithActor(actor AuditActor) *InvitationService {
+	scoped := *s
+	scoped.actor = &actor
+	return &scoped
+}
+
+// CreateInvitation invites an email address to an organization with the given
+// role and emails the single-use token. The raw token is also returned so the
+// admin can pass it on if the mail does not arrive. A nil expiresAt uses the
+// configured lifetime.
+func (s *InvitationService) CreateInvitation(orgID uint, email, role string, invitedByID uint, expiresAt *time.Time) (*models.Invitation, string, error) {
+	if !models.IsOrgRole(role) {
+		return nil, "", ErrInvalidOrgRole
+	}
+	var org models.Organization
+	if err := s.db.First(&org, orgID).Error; err != nil {
+		return nil, "", err
+	}
+
+	invitation := &models.Invitation{
+		OrganizationID: &orgID,
+		Email:          strings.TrimSpace(email),
+		Role:           role,
+		UserRole:       "user",
+		InvitedByID:    invitedByID,
+	}
+	subject := fmt.Sprintf("You have been invited to %s", org.Name)
+	token, err := s.issue(invitation, expiresAt, subject, func(token, expires string) string {
+		return fmt.Sprintf("Hi,\n\nYou have been invited to join %s as %s. If you already have an account, sign in with this email address and send POST %s/invitations/%s/accept. Otherwise send the same request with a username and password to create your account. The invitation expires on %s.",
+			org.Name, role, config.AppConfig.BaseURL, token, expires)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// CreateSignupInvitation invites an email address to register an account with
+// the given role and emails the single-use token. The raw token is also returned.
+// A nil expiresAt uses the configured lifetime.
+func (s *InvitationService) CreateSignupInvitation(email, userRole string, invitedByID uint, expiresAt *time.Time) (*models.Invitation, string, error) {
+	if err := s.db.Where("name = ?", userRole).First(&models.Role{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrUnknownRole
+		}
+		return nil, "", err
+	}
+
+	invitation := &models.Invitation{
+		Email:       strings.TrimSpace(email),
+		UserRole:    userRole,
+		InvitedByID: invitedByID,
+	}
+	token, err := s.issue(invitation, expiresAt, "You have been invited to create an account", func(token, expires string) string {
+		return fmt.Sprintf("Hi,\n\nYou have been invited to create an account. Register by sending POST %s/invitations/%s/accept with a username and password. The invitation expires on %s.",
+			config.AppConfig.BaseURL, token, expires)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// ListInvitations returns the invitations of an organization, or the sign-up
+// invitations when orgID is nil, newest first
+func (s *InvitationService) ListInvitations(orgID *uint) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	if err := s.db.Scopes(invitationScope(orgID)).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation revokes a pending invitation of an organization, or a
+// sign-up invitation when orgID is nil. Other invitations are reported as not found.
+func (s *InvitationService) RevokeInvitation(orgID *uint, invitationID uint) error {
+	result := s.db.Model(&models.Invitation{}).Scopes(invitationScope(orgID)).
+		Where("id = ? AND revoked_at IS NULL AND accepted_at IS NULL", invitationID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation redeems an organization invitation for the user, who must
+// own the invited email address, and makes them a member of the organization.
+// Existing members keep their current role.
+func (s *InvitationService) AcceptInvitation(rawToken string, user *models.User) (*models.OrganizationMembership, error) {
+	var membership *models.OrganizationMembership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := claimInvitation(tx, rawToken, user.ID, func(invitation *models.Invitation) error {
+			if invitation.OrganizationID == nil {
+				return ErrInvitationNeedsRegistration
+			}
+			if !strings.EqualFold(invitation.Email, user.Email) {
+				return ErrInvitationEmailMismatch
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		membership, err = joinOrganization(tx, invitation, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// RegisterWithInvitation creates an account for the invitee. The email address
+// and account role come from the invitation; the email counts as verified since
+// the token was delivered to it. Organization invitations also make the new
+// user a member. The returned membership is nil for sign-up invitations.
+func (s *InvitationService) RegisterWithInvitation(rawToken string, user *models.User) (*models.OrganizationMembership, error) {
+	var membership *models.OrganizationMembership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := usableInvitation(tx, rawToken)
+		if err != nil {
+			return err
+		}
+		var existing int64
+		if err := tx.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", invitation.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrInvitationEmailRegistered
+		}
+
+		user.Email = invitation.Email
+		user.Role = invitation.UserRole
+		users := NewUserService(tx)
+		if s.actor != nil {
+			users = users.WithActor(*s.actor)
+		}
+		if err := users.CreateUser(user); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(user).Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now}).Error; err != nil {
+			return err
+		}
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+
+		if err := markInvitationAccepted(tx, invitation, user.ID); err != nil {
+			return err
+		}
+		if invitation.OrganizationID != nil {
+			membership, err = joinOrganization(tx, invitation, user.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// issue stores the invitation with a fresh token and emails it, with body
+// composing the message from the raw token and the expiry. The invitation is
+// only kept if the email went out.
+func (s *InvitationService) issue(invitation *models.Invitation, expiresAt *time.Time, subject string, body func(token, expires string) string) (string, error) {
+	invitation.ExpiresAt = time.Now().Add(invitationTTL())
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return "", ErrInvalidInvitationExpiry
+		}
+		invitation.ExpiresAt = *expiresAt
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	invitation.TokenHash = utils.HashToken(token)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(invitation).Error; err != nil {
+			return err
+		}
+		return s.mailer.Send(mailer.Message{
+			To:      invitation.Email,
+			Subject: subject,
+			Body:    body(token, invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// invitationScope restricts a query to one organization's invitations, or to
+// sign-up invitations when orgID is nil
+func invitationScope(orgID *uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if orgID == nil {
+			return db.Where("organization_id IS NULL")
+		}
+		return db.Where("organization_id = ?", *orgID)
+	}
+}
+
+// joinOrganization makes userID a member of the invitation's organization with
+// the invited role, unless they already are one
+func joinOrganization(tx *gorm.DB, invitation *models.Invitation, userID uint) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
+	err := tx.Where("organization_id = ? AND user_id = ?", *invitation.OrganizationID, userID).First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		membership = models.OrganizationMembership{OrganizationID: *invitation.OrganizationID, UserID: userID, Role: invitation.Role}
+		err = tx.Create(&membership).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// claimInvitation looks up a usable invitation by its raw token, runs check on
+// it and marks it accepted by userID
+func claimInvitation(tx *gorm.DB, rawToken string, userID uint, check func(*models.Invitation) error) (*models.Invitation, error) {
+	invitation, err := usableInvitation(tx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(invitation); err != nil {
+		return nil, err
+	}
+	if err := markInvitationAccepted(tx, invitation, userID); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// usableInvitation looks up an invitation that is neither expired, revoked nor used
+func usableInvitation(tx *gorm.DB, rawToken string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := tx.Where("token_hash = ?", utils.HashToken(rawToken)).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	return &invitation, nil
+}
+
+// pendingSignupInvitation returns the newest usable sign-up invitation for email,
+// for registrations that do not present the invitation token themselves
+func pendingSignupInvitation(tx *gorm.DB, email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := tx.Where("organization_id IS NULL AND LOWER(email) = LOWER(?) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, time.Now()).
+		Order("created_at DESC").
+		First(&invitation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// markInvitationAccepted records that userID used the invitation. The
+// conditional update makes sure concurrent requests cannot both use it.
+func markInvitationAccepted(tx *gorm.DB, invitation *models.Invitation, userID uint) error {
+	now := time.Now()
+	result := tx.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"accepted_at": now, "accepted_by_id": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidInvitation
+	}
+	invitation.AcceptedAt = &now
+	invitation.AcceptedByID = &userID
+	return nil
+}
+
+// invitationTTL returns the configured lifetime of invitations
+func invitationTTL() time.Duration {
+	if config.AppConfig.InvitationTTL > 0 {
+		return config.AppConfig.InvitationTTL
+	}
+	return defaultInvitationTTL
+}
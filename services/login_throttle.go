@@ -0,0 +1,296 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginLocked is returned while an account or client IP is locked out
+var ErrLoginLocked = errors.New("too many failed login attempts")
+
+// Key prefixes used by LoginThrottler in its AttemptStore
+const (
+	AttemptKeyAccount  = "account:"
+	AttemptKeyIP       = "ip:"
+	AttemptKeyMFA      = "mfa:"       // Second-factor failures per user ID
+	AttemptKeyMFAToken = "mfa-token:" // Second-factor failures per pending token (jti)
+)
+
+// AttemptRecord is the failed-login state tracked for one account or client IP
+type AttemptRecord struct {
+	Failures    int       `json:"failures"`     // Failures since the last lockout (account) or window start (IP)
+	Lockouts    int       `json:"lockouts"`     // Lockouts so far; drives the progressive backoff
+	WindowStart time.Time `json:"window_start"` // Start of the current IP counting window
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// AttemptStore persists failed-login state. MemoryAttemptStore suits a single
+// instance and tests; multiple instances need a shared implementation.
+type AttemptStore interface {
+	// Get returns the record for key, if any
+	Get(key string) (AttemptRecord, bool)
+	// Update atomically applies fn to the record for key (zero value if absent) and stores the result
+	Update(key string, fn func(rec *AttemptRecord)) AttemptRecord
+	// Delete removes the record for key
+	Delete(key string)
+	// List returns a snapshot of all records
+	List() map[string]AttemptRecord
+}
+
+// MemoryAttemptStore is an in-process AttemptStore
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	records map[string]AttemptRecord
+}
+
+// NewMemoryAttemptStore creates an empty MemoryAttemptStore
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{records: make(map[string]AttemptRecord)}
+}
+
+func (m *MemoryAttemptStore) Get(key string) (AttemptRecord, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[key]
+	return rec, ok
+}
+
+func (m *MemoryAttemptStore) Update(key string, fn func(rec *AttemptRecord)) AttemptRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := m.records[key]
+	fn(&rec)
+	m.records[key] = rec
+	return rec
+}
+
+func (m *MemoryAttemptStore) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+}
+
+func (m *MemoryAttemptStore) List() map[string]AttemptRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]AttemptRecord, len(m.records))
+	for k, v := range m.records {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// Lockout describes a currently locked account or IP, as shown to admins
+type Lockout struct {
+	Type        string    `json:"type"` // "account", "ip" or "mfa"
+	Key         string    `json:"key"`  // Email address, IP or user ID
+	Failures    int       `json:"failures"`
+	Lockouts    int       `json:"lockouts"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginThrottler tracks failed logins per account and per client IP. Accounts are
+// locked for progressively longer periods; IPs are limited per time window.
+type LoginThrottler struct {
+	store     AttemptStore
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewLoginThrottler creates a LoginThrottler backed by store
+func NewLoginThrottler(store AttemptStore) *LoginThrottler {
+	return &LoginThrottler{store: store}
+}
+
+// Check returns ErrLoginLocked, and how long to wait, if the account or IP is locked
+func (t *LoginThrottler) Check(email, ip string) (time.Duration, error) {
+	return t.check(accountKey(email), AttemptKeyIP+ip)
+}
+
+// RecordFailure counts a failed login. Failures are tracked for the email whether
+// or not an account exists, so lockout behaviour does not reveal registrations.
+func (t *LoginThrottler) RecordFailure(email, ip string) {
+	now := time.Now()
+	t.recordAccountFailure(accountKey(email), now)
+	t.recordIPFailure(ip, now)
+	t.sweep(now)
+}
+
+// RecordSuccess clears the failure history of an account after a successful login
+func (t *LoginThrottler) RecordSuccess(email string) {
+	t.store.Delete(accountKey(email))
+}
+
+// CheckMFA is Check for the second login step, where the user is known from the
+// pending token. Second-factor failures lock the user out of that step with the
+// same progressive backoff as failed passwords.
+func (t *LoginThrottler) CheckMFA(userID uint, ip string) (time.Duration, error) {
+	return t.check(mfaKey(userID), AttemptKeyIP+ip)
+}
+
+// RecordMFAFailure counts a wrong second-factor code for the user, the client IP
+// and the pending token jti, and returns how many codes that token has failed
+func (t *LoginThrottler) RecordMFAFailure(userID uint, jti, ip string) int {
+	now := time.Now()
+	t.recordAccountFailure(mfaKey(userID), now)
+	t.recordIPFailure(ip, now)
+	rec := t.store.Update(AttemptKeyMFAToken+jti, func(rec *AttemptRecord) {
+		rec.Failures++
+		rec.LastFailure = now
+	})
+	t.sweep(now)
+	return rec.Failures
+}
+
+// RecordMFASuccess clears the second-factor failure history of a user and token
+func (t *LoginThrottler) RecordMFASuccess(userID uint, jti string) {
+	t.store.Delete(mfaKey(userID))
+	t.store.Delete(AttemptKeyMFAToken + jti)
+}
+
+// check returns ErrLoginLocked, and the longest wait, if any of keys is locked
+func (t *LoginThrottler) check(keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		if rec, ok := t.store.Get(key); ok && now.Before(rec.LockedUntil) {
+			if d := rec.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return wait, ErrLoginLocked
+	}
+	return 0, nil
+}
+
+// recordAccountFailure counts a failure against an account-like key, locking it
+// once the threshold is reached
+func (t *LoginThrottler) recordAccountFailure(key string, now time.Time) {
+	cfg := config.AppConfig.Lockout
+	t.store.Update(key, func(rec *AttemptRecord) {
+		if !rec.LastFailure.IsZero() && now.Sub(rec.LastFailure) > cfg.ResetAfter {
+			*rec = AttemptRecord{}
+		}
+		rec.Failures++
+		rec.LastFailure = now
+		if cfg.Threshold > 0 && rec.Failures >= cfg.Threshold {
+			rec.Lockouts++
+			rec.Failures = 0
+			rec.LockedUntil = now.Add(lockoutDuration(rec.Lockouts))
+		}
+	})
+}
+
+// recordIPFailure counts a failure against a client IP within the current window
+func (t *LoginThrottler) recordIPFailure(ip string, now time.Time) {
+	cfg := config.AppConfig.Lockout
+	t.store.Update(AttemptKeyIP+ip, func(rec *AttemptRecord) {
+		if now.Sub(rec.WindowStart) > cfg.IPWindow {
+			rec.WindowStart = now
+			rec.Failures = 0
+		}
+		rec.Failures++
+		rec.LastFailure = now
+		if cfg.IPMaxAttempts > 0 && rec.Failures >= cfg.IPMaxAttempts {
+			rec.Lockouts++
+			rec.LockedUntil = rec.WindowStart.Add(cfg.IPWindow)
+		}
+	})
+}
+
+// Lockouts lists accounts and IPs that are currently locked
+func (t *LoginThrottler) Lockouts() []Lockout {
+	now := time.Now()
+	var lockouts []Lockout
+	for key, rec := range t.store.List() {
+		if !now.Before(rec.LockedUntil) {
+			continue
+		}
+		lockout := Lockout{Failures: rec.Failures, Lockouts: rec.Lockouts, LockedUntil: rec.LockedUntil}
+		switch {
+		case strings.HasPrefix(key, AttemptKeyAccount):
+			lockout.Type, lockout.Key = "account", strings.TrimPrefix(key, AttemptKeyAccount)
+		case strings.HasPrefix(key, AttemptKeyIP):
+			lockout.Type, lockout.Key = "ip", strings.TrimPrefix(key, AttemptKeyIP)
+		case strings.HasPrefix(key, AttemptKeyMFA):
+			lockout.Type, lockout.Key = "mfa", strings.TrimPrefix(key, AttemptKeyMFA)
+		default:
+			continue
+		}
+		lockouts = append(lockouts, lockout)
+	}
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil) })
+	return lockouts
+}
+
+// ClearAccount removes the lockout and failure history of an account
+func (t *LoginThrottler) ClearAccount(email string) {
+	t.store.Delete(accountKey(email))
+}
+
+// ClearMFA removes the second-factor lockout and failure history of a user
+func (t *LoginThrottler) ClearMFA(userID uint) {
+	t.store.Delete(mfaKey(userID))
+}
+
+// ClearIP removes the lockout and failure history of a client IP
+func (t *LoginThrottler) ClearIP(ip string) {
+	t.store.Delete(AttemptKeyIP + ip)
+}
+
+// sweep drops stale records at most once a minute so the store does not grow without bound
+func (t *LoginThrottler) sweep(now time.Time) {
+	t.mu.Lock()
+	if now.Sub(t.lastSweep) < time.Minute {
+		t.mu.Unlock()
+		return
+	}
+	t.lastSweep = now
+	t.mu.Unlock()
+
+	cfg := config.AppConfig.Lockout
+	for key, rec := range t.store.List() {
+		stale := cfg.ResetAfter
+		switch {
+		case strings.HasPrefix(key, AttemptKeyIP):
+			stale = cfg.IPWindow
+		case strings.HasPrefix(key, AttemptKeyMFAToken):
+			// Pending tokens are useless once expired
+			stale = mfaPendingTTL()
+		}
+		if now.After(rec.LockedUntil) && now.Sub(rec.LastFailure) > stale {
+			t.store.Delete(key)
+		}
+	}
+}
+
+// lockoutDuration doubles the base lockout for every previous lockout, up to the maximum
+func lockoutDuration(lockouts int) time.Duration {
+	cfg := config.AppConfig.Lockout
+	d := cfg.BaseDuration
+	for i := 1; i < lockouts && d < cfg.MaxDuration; i++ {
+		d *= 2
+	}
+	if cfg.MaxDuration > 0 && d > cfg.MaxDuration {
+		d = cfg.MaxDuration
+	}
+	return d
+}
+
+// mfaKey is the store key of a user's second-factor failures
+func mfaKey(userID uint) string {
+	return AttemptKeyMFA + strconv.FormatUint(uint64(userID), 10)
+}
+
+// accountKey normalises an email into its store key
+func accountKey(email string) string {
+	return AttemptKeyAccount + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withLockoutConfig installs lockout settings for the duration of a test
+func withLockoutConfig(t *testing.T, cfg config.LockoutConfig) {
+	t.Helper()
+	saved := config.AppConfig.Lockout
+	config.AppConfig.Lockout = cfg
+	t.Cleanup(func() { config.AppConfig.Lockout = saved })
+}
+
+func testLockoutConfig() config.LockoutConfig {
+	return config.LockoutConfig{
+		Threshold:     3,
+		BaseDuration:  time.Minute,
+		MaxDuration:   4 * time.Minute,
+		ResetAfter:    time.Hour,
+		IPMaxAttempts: 100,
+		IPWindow:      15 * time.Minute,
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	store := NewMemoryAttemptStore()
+
+	if _, ok := store.Get("account:a@example.com"); ok {
+		t.Fatal("Get on an empty store found a record")
+	}
+
+	rec := store.Update("account:a@example.com", func(rec *AttemptRecord) { rec.Failures++ })
+	rec = store.Update("account:a@example.com", func(rec *AttemptRecord) { rec.Failures++ })
+	if rec.Failures != 2 {
+		t.Errorf("Update returned %d failures, want 2", rec.Failures)
+	}
+	if got, ok := store.Get("account:a@example.com"); !ok || got.Failures != 2 {
+		t.Errorf("Get = %+v, %v; want 2 failures", got, ok)
+	}
+
+	snapshot := store.List()
+	store.Update("ip:10.0.0.1", func(rec *AttemptRecord) { rec.Failures = 1 })
+	if len(snapshot) != 1 {
+		t.Errorf("List snapshot changed after a later Update: %v", snapshot)
+	}
+
+	store.Delete("account:a@example.com")
+	if _, ok := store.Get("account:a@example.com"); ok {
+		t.Error("record still present after Delete")
+	}
+	if len(store.List()) != 1 {
+		t.Errorf("Delete removed the wrong records: %v", store.List())
+	}
+}
+
+func TestMemoryAttemptStoreConcurrentUpdates(t *testing.T) {
+	store := NewMemoryAttemptStore()
+
+	const workers, updates = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				store.Update("ip:10.0.0.1", func(rec *AttemptRecord) { rec.Failures++ })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rec, _ := store.Get("ip:10.0.0.1"); rec.Failures != workers*updates {
+		t.Errorf("Failures = %d, want %d", rec.Failures, workers*updates)
+	}
+}
+
+func TestLoginThrottlerLocksAccountAtThreshold(t *testing.T) {
+	withLockoutConfig(t, testLockoutConfig())
+	throttler := NewLoginThrottler(NewMemoryAttemptStore())
+
+	for i := 0; i < 2; i++ {
+		throttler.RecordFailure("alice@example.com", "10.0.0.1")
+		if _, err := throttler.Check("alice@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("locked after %d failures: %v", i+1, err)
+		}
+	}
+
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+	wait, err := throttler.Check("alice@example.com", "10.0.0.2")
+	if !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("Check error = %v, want ErrLoginLocked", err)
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("wait = %v, want up to the one minute base duration", wait)
+	}
+
+	// The email is normalised, and other accounts are unaffected
+	if _, err := throttler.Check("  ALICE@example.com ", "10.0.0.2"); !errors.Is(err, ErrLoginLocked) {
+		t.Errorf("differently written email is not locked: %v", err)
+	}
+	if _, err := throttler.Check("bob@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("another account is locked: %v", err)
+	}
+
+	lockouts := throttler.Lockouts()
+	if len(lockouts) != 1 || lockouts[0].Type != "account" || lockouts[0].Key != "alice@example.com" {
+		t.Errorf("Lockouts = %+v, want the alice account", lockouts)
+	}
+
+	throttler.ClearAccount("alice@example.com")
+	if _, err := throttler.Check("alice@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("still locked after ClearAccount: %v", err)
+	}
+}
+
+func TestLoginThrottlerSuccessResetsFailures(t *testing.T) {
+	withLockoutConfig(t, testLockoutConfig())
+	throttler := NewLoginThrottler(NewMemoryAttemptStore())
+
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+	throttler.RecordSuccess("alice@example.com")
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+
+	if _, err := throttler.Check("alice@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("locked although a success cleared earlier failures: %v", err)
+	}
+}
+
+func TestLoginThrottlerStaleFailuresAreForgotten(t *testing.T) {
+	withLockoutConfig(t, testLockoutConfig())
+	store := NewMemoryAttemptStore()
+	throttler := NewLoginThrottler(store)
+
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+	store.Update(accountKey("alice@example.com"), func(rec *AttemptRecord) {
+		rec.LastFailure = rec.LastFailure.Add(-2 * time.Hour)
+	})
+	throttler.RecordFailure("alice@example.com", "10.0.0.1")
+
+	if _, err := throttler.Check("alice@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("failures older than ResetAfter still counted: %v", err)
+	}
+}
+
+func TestLoginThrottlerProgressiveBackoff(t *testing.T) {
+	withLockoutConfig(t, testLockoutConfig())
+	store := NewMemoryAttemptStore()
+	throttler := NewLoginThrottler(store)
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for i, duration := range want {
+		for j := 0; j < 3; j++ {
+			throttler.RecordFailure("alice@example.com", "10.0.0.1")
+		}
+		rec, _ := store.Get(accountKey("alice@example.com"))
+		if got := rec.LockedUntil.Sub(rec.LastFailure); got != duration {
+			t.Errorf("lockout %d lasts %v, want %v", i+1, got, duration)
+		}
+		// Let the lockout run out without forgetting it happened
+		store.Update(accountKey("alice@example.com"), func(rec *AttemptRecord) { rec.LockedUntil = time.Time{} })
+	}
+}
+
+func TestLoginThrottlerLimitsIPs(t *testing.T) {
+	cfg := testLockoutConfig()
+	cfg.IPMaxAttempts = 5
+	withLockoutConfig(t, cfg)
+	throttler := NewLoginThrottler(NewMemoryAttemptStore())
+
+	// Spread over many accounts so no single account is locked
+	for i := 0; i < 5; i++ {
+		throttler.RecordFailure(string(rune('a'+i))+"@example.com", "10.0.0.1")
+	}
+
+	wait, err := throttler.Check("new@example.com", "10.0.0.1")
+	if !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("Check error = %v, want ErrLoginLocked", err)
+	}
+	if wait <= 0 || wait > cfg.IPWindow {
+		t.Errorf("wait = %v, want within the IP window", wait)
+	}
+	if _, err := throttler.Check("new@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("another IP is locked: %v", err)
+	}
+
+	throttler.ClearIP("10.0.0.1")
+	if _, err := throttler.Check("new@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("still locked after ClearIP: %v", err)
+	}
+}
+
+func TestLoginThrottlerMFAFailures(t *testing.T) {
+	withLockoutConfig(t, testLockoutConfig())
+	throttler := NewLoginThrottler(NewMemoryAttemptStore())
+
+	if n := throttler.RecordMFAFailure(7, "token-1", "10.0.0.1"); n != 1 {
+		t.Errorf("first failure of token-1 counted as %d", n)
+	}
+	if n := throttler.RecordMFAFailure(7, "token-2", "10.0.0.1"); n != 1 {
+		t.Errorf("failures of token-1 counted for token-2: %d", n)
+	}
+	if _, err := throttler.CheckMFA(7, "10.0.0.1"); err != nil {
+		t.Fatalf("locked after 2 failures: %v", err)
+	}
+	if n := throttler.RecordMFAFailure(7, "token-2", "10.0.0.1"); n != 2 {
+		t.Errorf("second failure of token-2 counted as %d", n)
+	}
+
+	// A fresh pending token does not escape the per-user lockout
+	if _, err := throttler.CheckMFA(7, "10.0.0.2"); !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("CheckMFA error = %v, want ErrLoginLocked", err)
+	}
+	if _, err := throttler.CheckMFA(8, "10.0.0.2"); err != nil {
+		t.Errorf("another user is locked: %v", err)
+	}
+	// Second-factor failures do not lock the password step of an unrelated email
+	if _, err := throttler.Check("bob@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("password login is locked: %v", err)
+	}
+
+	lockouts := throttler.Lockouts()
+	if len(lockouts) != 1 || lockouts[0].Type != "mfa" || lockouts[0].Key != "7" {
+		t.Errorf("Lockouts = %+v, want the mfa lockout of user 7", lockouts)
+	}
+
+	throttler.ClearMFA(7)
+	if _, err := throttler.CheckMFA(7, "10.0.0.1"); err != nil {
+		t.Errorf("still locked after ClearMFA: %v", err)
+	}
+
+	throttler.RecordMFASuccess(7, "token-2")
+	if n := throttler.RecordMFAFailure(7, "token-2", "10.0.0.1"); n != 1 {
+		t.Errorf("RecordMFASuccess did not reset token-2, count %d", n)
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/utils"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has TOTP enabled
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming or using TOTP before enrollment has started
+	ErrMFANotEnrolled = errors.New("two-factor authentication is not enrolled")
+	// ErrInvalidMFACode is returned for wrong, expired or replayed TOTP and recovery codes
+	ErrInvalidMFACode = errors.New("invalid two-factor authentication code")
+	// ErrMFARequiredForRole is returned when a user whose role or permissions mandate TOTP tries to disable it
+	ErrMFARequiredForRole = errors.New("two-factor authentication is mandatory for this role")
+)
+
+// recoveryCodeCount is the number of recovery codes handed out at enrollment
+const recoveryCodeCount = 10
+
+// defaultMFAPendingTTL is used when the configuration does not provide a lifetime
+const defaultMFAPendingTTL = 5 * time.Minute
+
+// defaultMFAMaxAttempts is used when the configuration does not limit wrong codes
+const defaultMFAMaxAttempts = 3
+
+// TOTPEnrollment is returned when enrollment starts so the client can render a QR code
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAService manages TOTP enrollment and second-factor verification
+type MFAService struct {
+	db *gorm.DB
+}
+
+// NewMFAService creates a new MFAService
+func NewMFAService(db *gorm.DB) *MFAService {
+	return &MFAService{db: db}
+}
+
+// RoleRequiresMFA reports whether users with the given role must use two-factor authentication
+func RoleRequiresMFA(role string) bool {
+	for _, r := range config.AppConfig.MFARequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionsRequireMFA reports whether a session must have completed two-factor
+// authentication before using elevated permissions
+func PermissionsRequireMFA() bool {
+	return config.AppConfig.MFAForPermissions
+}
+
+// RequiresMFA reports whether the user must use two-factor authentication, either
+// because of their primary role or because any of their roles grants an elevated
+// permission
+func (s *MFAService) RequiresMFA(user *models.User) (bool, error) {
+	if RoleRequiresMFA(user.Role) {
+		return true, nil
+	}
+	if !PermissionsRequireMFA() {
+		return false, nil
+	}
+	perms, err := NewRoleService(s.db).PermissionsForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(perms) > 0, nil
+}
+
+// BeginEnrollment generates a new pending TOTP secret for the user. Any earlier
+// unconfirmed secret is replaced.
+func (s *MFAService) BeginEnrollment(userID uint) (*TOTPEnrollment, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&user).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    utils.TOTPURI(config.AppConfig.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables TOTP once the user proves their authenticator works,
+// and returns a fresh set of recovery codes. The codes are only shown this once.
+func (s *MFAService) ConfirmEnrollment(userID uint, code string) ([]string, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.ID, codes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns TOTP off after checking a current code. Users whose role
+// mandates two-factor authentication cannot disable it.
+func (s *MFAService) Disable(userID uint, code string) error {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnrolled
+	}
+	required, err := s.RequiresMFA(&user)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequiredForRole
+	}
+	if err := s.VerifyCode(&user, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// VerifyCode accepts either a current TOTP code or an unused recovery code.
+// Each TOTP time step and each recovery code can only be used once.
+func (s *MFAService) VerifyCode(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnrolled
+	}
+
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// Conditional update rejects a replay of this or an earlier code
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// IssuePendingToken returns a short-lived token proving the password step succeeded.
+// It can only be exchanged for real tokens together with a valid second factor.
+// The scopes requested at login travel with it to the final tokens.
+func (s *MFAService) IssuePendingToken(user *models.User, scopes []string) (string, error) {
+	return utils.GenerateScopedActionToken(utils.PurposeMFAPending, user.ID, utils.FormatScope(scopes), mfaPendingTTL())
+}
+
+// PendingLogin validates a pending token that has not been used or invalidated yet
+func (s *MFAService) PendingLogin(pendingToken string) (*utils.ActionClaims, error) {
+	claims, err := utils.ValidateActionToken(pendingToken, utils.PurposeMFAPending)
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidMFACode
+	}
+
+	var revoked int64
+	if err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked).Error; err != nil {
+		return nil, err
+	}
+	if revoked > 0 {
+		return nil, ErrInvalidMFACode
+	}
+	return claims, nil
+}
+
+// CompleteLogin checks the second factor for a pending login and returns the user
+// together with the scopes requested at login. The pending token is consumed, so
+// it cannot be exchanged for tokens a second time.
+func (s *MFAService) CompleteLogin(pending *utils.ActionClaims, code string) (*models.User, []string, error) {
+	var user models.User
+	if err := s.db.First(&user, pending.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMFACode
+		}
+		return nil, nil, err
+	}
+	if err := s.VerifyCode(&user, code); err != nil {
+		return nil, nil, err
+	}
+	// The account may have been disabled since the password step
+	if err := CheckAccountStatus(&user); err != nil {
+		return nil, nil, err
+	}
+
+	consumed, err := s.revokePendingToken(pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !consumed {
+		// A concurrent request used the same token first
+		return nil, nil, ErrInvalidMFACode
+	}
+	return &user, pending.Scopes(), nil
+}
+
+// InvalidatePendingLogin revokes a pending token, e.g. after too many wrong codes,
+// so the password step has to be repeated
+func (s *MFAService) InvalidatePendingLogin(pending *utils.ActionClaims) error {
+	_, err := s.revokePendingToken(pending)
+	return err
+}
+
+// revokePendingToken adds the pending token's jti to the revocation list and
+// reports whether this call was the one that revoked it
+func (s *MFAService) revokePendingToken(pending *utils.ActionClaims) (bool, error) {
+	entry := models.RevokedToken{JTI: pending.ID, UserID: pending.UserID, ExpiresAt: pending.ExpiresAt.Time}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// MaxPendingLoginAttempts returns how many wrong codes a pending token survives
+func MaxPendingLoginAttempts() int {
+	if config.AppConfig.MFAMaxAttempts > 0 {
+		return config.AppConfig.MFAMaxAttempts
+	}
+	return defaultMFAMaxAttempts
+}
+
+// replaceRecoveryCodes swaps out a user's recovery codes, storing only hashes
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	records := make([]models.RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}
+	}
+	return tx.Create(&records).Error
+}
+
+// mfaPendingTTL returns the configured lifetime of MFA pending tokens
+func mfaPendingTTL() time.Duration {
+	if config.AppConfig.MFAPendingTTL > 0 {
+		return config.AppConfig.MFAPendingTTL
+	}
+	return defaultMFAPendingTTL
+}
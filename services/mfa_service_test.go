@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gocheck/models"
+	"gocheck/testdb"
+	"testing"
+	"time"
+)
+
+// totpAt computes the RFC 6238 code of a secret for a time step
+func totpAt(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode TOTP secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	o := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[o:o+4])&0x7fffffff)%1000000)
+}
+
+// currentStep returns the TOTP time step of the current time
+func currentStep() int64 {
+	return time.Now().Unix() / 30
+}
+
+// enrollTestUser enables TOTP for the user and returns their secret, recovery
+// codes and the time step used up by the confirmation
+func enrollTestUser(t *testing.T, mfa *MFAService, user *models.User) (string, []string, int64) {
+	t.Helper()
+	enrollment, err := mfa.BeginEnrollment(user.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	step := currentStep()
+	codes, err := mfa.ConfirmEnrollment(user.ID, totpAt(t, enrollment.Secret, step))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	return enrollment.Secret, codes, step
+}
+
+func TestConfirmEnrollmentNeedsValidCode(t *testing.T) {
+	db := testdb.Open(t)
+	mfa := NewMFAService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	enrollment, err := mfa.BeginEnrollment(user.ID)
+	if err != nil {
+		t.Fatalf("BeginEnrollment: %v", err)
+	}
+	step := currentStep()
+	if _, err := mfa.ConfirmEnrollment(user.ID, totpAt(t, enrollment.Secret, step+5)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("code outside the drift window: error = %v, want ErrInvalidMFACode", err)
+	}
+	codes, err := mfa.ConfirmEnrollment(user.ID, totpAt(t, enrollment.Secret, step))
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Errorf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if _, err := mfa.BeginEnrollment(user.ID); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("second enrollment error = %v, want ErrMFAAlreadyEnabled", err)
+	}
+}
+
+func TestVerifyCodeRejectsReplay(t *testing.T) {
+	db := testdb.Open(t)
+	mfa := NewMFAService(db)
+	user := testdb.CreateUser(t, db, "user")
+	secret, _, step := enrollTestUser(t, mfa, user)
+	if err := db.First(user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The code used to confirm enrollment cannot be used again
+	if err := mfa.VerifyCode(user, totpAt(t, secret, step)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed enrollment code: error = %v, want ErrInvalidMFACode", err)
+	}
+	// The next step is within the drift window and has not been used yet
+	if err := mfa.VerifyCode(user, totpAt(t, secret, step+1)); err != nil {
+		t.Fatalf("next code rejected: %v", err)
+	}
+	if err := mfa.VerifyCode(user, totpAt(t, secret, step+1)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("replayed code: error = %v, want ErrInvalidMFACode", err)
+	}
+	// An older code is rejected once a newer one was accepted
+	if err := mfa.VerifyCode(user, totpAt(t, secret, step-1)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("earlier code after a later one: error = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestVerifyCodeRecoveryCodesAreSingleUse(t *testing.T) {
+	db := testdb.Open(t)
+	mfa := NewMFAService(db)
+	user := testdb.CreateUser(t, db, "user")
+	_, codes, _ := enrollTestUser(t, mfa, user)
+	if err := db.First(user, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mfa.VerifyCode(user, codes[0]); err != nil {
+		t.Fatalf("recovery code rejected: %v", err)
+	}
+	if err := mfa.VerifyCode(user, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("reused recovery code: error = %v, want ErrInvalidMFACode", err)
+	}
+	if err := mfa.VerifyCode(user, "aaaaa-aaaaa"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("unknown recovery code: error = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestCompleteLoginConsumesPendingToken(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	mfa := NewMFAService(db)
+	user := testdb.CreateUser(t, db, "user")
+	_, codes, _ := enrollTestUser(t, mfa, user)
+
+	token, err := mfa.IssuePendingToken(user, []string{"books:read"})
+	if err != nil {
+		t.Fatalf("IssuePendingToken: %v", err)
+	}
+	pending, err := mfa.PendingLogin(token)
+	if err != nil {
+		t.Fatalf("PendingLogin: %v", err)
+	}
+	loggedIn, scopes, err := mfa.CompleteLogin(pending, codes[0])
+	if err != nil {
+		t.Fatalf("CompleteLogin: %v", err)
+	}
+	if loggedIn.ID != user.ID || len(scopes) != 1 || scopes[0] != "books:read" {
+		t.Errorf("CompleteLogin = user %d, scopes %v", loggedIn.ID, scopes)
+	}
+
+	// The token cannot be exchanged again, even with another valid code
+	if _, err := mfa.PendingLogin(token); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("PendingLogin of a used token: error = %v, want ErrInvalidMFACode", err)
+	}
+	if _, _, err := mfa.CompleteLogin(pending, codes[1]); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("second CompleteLogin: error = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestInvalidatePendingLogin(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	mfa := NewMFAService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	token, err := mfa.IssuePendingToken(user, nil)
+	if err != nil {
+		t.Fatalf("IssuePendingToken: %v", err)
+	}
+	pending, err := mfa.PendingLogin(token)
+	if err != nil {
+		t.Fatalf("PendingLogin: %v", err)
+	}
+	if err := mfa.InvalidatePendingLogin(pending); err != nil {
+		t.Fatalf("InvalidatePendingLogin: %v", err)
+	}
+	if _, err := mfa.PendingLogin(token); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("PendingLogin after invalidation: error = %v, want ErrInvalidMFACode", err)
+	}
+}
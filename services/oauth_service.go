@@ -0,0 +1,492 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/utils"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OAuth2 errors. Their messages are the RFC 6749 error codes returned to clients.
+var (
+	ErrOAuthInvalidRequest       = errors.New("invalid_request")
+	ErrOAuthInvalidClient        = errors.New("invalid_client")
+	ErrOAuthInvalidGrant         = errors.New("invalid_grant")
+	ErrOAuthUnauthorizedClient   = errors.New("unauthorized_client")
+	ErrOAuthUnsupportedGrantType = errors.New("unsupported_grant_type")
+	ErrOAuthInvalidScope         = errors.New("invalid_scope")
+	// ErrOAuthInvalidRedirectURI is returned for an unknown client or unregistered
+	// redirect URI; the user must not be redirected in that case
+	ErrOAuthInvalidRedirectURI = errors.New("invalid redirect_uri")
+)
+
+// defaultOAuthCodeTTL is used when the configuration does not provide a lifetime
+const defaultOAuthCodeTTL = 10 * time.Minute
+
+// AuthorizeRequest holds the parameters of an /oauth/authorize request
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuthTokenResponse is the RFC 6749 token endpoint response
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// Introspection is the RFC 7662 introspection response
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+}
+
+// OAuthService implements the OAuth2 authorization server. Access and refresh
+// tokens are issued by TokenService, so they are the same tokens AuthMiddleware accepts.
+type OAuthService struct {
+	db           *gorm.DB
+	tokenService *TokenService
+}
+
+// NewOAuthService creates a new OAuthService
+func NewOAuthService(db *gorm.DB) *OAuthService {
+	return &OAuthService{db: db, tokenService: NewTokenService(db)}
+}
+
+// RegisterClient registers a client owned by the user. The returned secret is
+// empty for public clients and is shown to the caller only once.
+func (s *OAuthService) RegisterClient(ownerID uint, name string, redirectURIs, scopes []string, confidential bool) (*models.OAuthClient, string, error) {
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", ErrOAuthInvalidRedirectURI
+		}
+	}
+	scopes, err := utils.NormalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		OwnerID:      ownerID,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       utils.FormatScope(scopes),
+		Confidential: confidential,
+	}
+
+	var secret string
+	if confidential {
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := s.db.Create(&client).Error; err != nil {
+		return nil, "", err
+	}
+	return &client, secret, nil
+}
+
+// ListClients returns the clients registered by the user
+func (s *OAuthService) ListClients(ownerID uint) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	if err := s.db.Where("owner_id = ?", ownerID).Order("created_at DESC").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// RevokeClient disables one of the user's clients and revokes the refresh tokens issued to it
+func (s *OAuthService) RevokeClient(ownerID, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var client models.OAuthClient
+		if err := tx.Where("id = ? AND owner_id = ? AND revoked_at IS NULL", id, ownerID).First(&client).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := tx.Model(&client).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("client_id = ? AND revoked_at IS NULL", client.ClientID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// AuthenticateClient checks client credentials. Public clients present no secret.
+func (s *OAuthService) AuthenticateClient(clientID, secret string) (*models.OAuthClient, error) {
+	client, err := s.activeClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Confidential {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return nil, ErrOAuthInvalidClient
+		}
+	} else if secret != "" {
+		return nil, ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// ValidateAuthorizeRequest checks an authorization request and returns the client
+// and the scopes to ask the user to consent to. ErrOAuthInvalidRedirectURI means the
+// error must be shown to the user; other errors may be sent to the redirect URI.
+func (s *OAuthService) ValidateAuthorizeRequest(req AuthorizeRequest) (*models.OAuthClient, []string, error) {
+	client, err := s.activeClient(req.ClientID)
+	if err != nil {
+		return nil, nil, ErrOAuthInvalidRedirectURI
+	}
+	if !containsString(client.RedirectURIList(), req.RedirectURI) {
+		return nil, nil, ErrOAuthInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, ErrOAuthInvalidRequest
+	}
+	// PKCE is required for every client; only the S256 method is accepted
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return client, nil, ErrOAuthInvalidRequest
+	}
+
+	scopes, err := s.grantableScopes(client, req.Scope)
+	if err != nil {
+		return client, nil, err
+	}
+	return client, scopes, nil
+}
+
+// IssueAuthorizationCode records the user's consent and returns a single-use code
+func (s *OAuthService) IssueAuthorizationCode(client *models.OAuthClient, userID uint, req AuthorizeRequest, scopes []string) (string, error) {
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	record := models.OAuthAuthorizationCode{
+		CodeHash:            utils.HashToken(code),
+		ClientID:            client.ClientID,
+		UserID:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               utils.FormatScope(scopes),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		ExpiresAt:           time.Now().Add(oauthCodeTTL()),
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeAuthorizationCode implements the authorization_code grant with PKCE
+func (s *OAuthService) ExchangeAuthorizationCode(client *models.OAuthClient, code, redirectURI, codeVerifier string) (*OAuthTokenResponse, error) {
+	if code == "" || codeVerifier == "" {
+		return nil, ErrOAuthInvalidRequest
+	}
+
+	var response *OAuthTokenResponse
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var record models.OAuthAuthorizationCode
+		if err := tx.Where("code_hash = ?", utils.HashToken(code)).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOAuthInvalidGrant
+			}
+			return err
+		}
+		if record.UsedAt != nil || time.Now().After(record.ExpiresAt) ||
+			record.ClientID != client.ClientID || record.RedirectURI != redirectURI ||
+			!verifyPKCE(record.CodeChallenge, codeVerifier) {
+			return ErrOAuthInvalidGrant
+		}
+
+		// Conditional update so the code cannot be exchanged twice concurrently
+		result := tx.Model(&models.OAuthAuthorizationCode{}).
+			Where("id = ? AND used_at IS NULL", record.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOAuthInvalidGrant
+		}
+
+		var user models.User
+		if err := tx.First(&user, record.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOAuthInvalidGrant
+			}
+			return err
+		}
+		if CheckAccountStatus(&user) != nil {
+			return ErrOAuthInvalidGrant
+		}
+
+		familyID, err := utils.GenerateRandomToken(24)
+		if err != nil {
+			return err
+		}
+		scopes := strings.Fields(record.Scope)
+		pair, err := s.tokenService.issue(tx, &user, familyID, TokenGrant{Scopes: scopes, ClientID: client.ClientID})
+		if err != nil {
+			return err
+		}
+		response = tokenResponse(pair, record.Scope)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// RefreshToken implements the refresh_token grant. Refresh tokens are bound to the
+// client they were issued to. A narrower scope may be requested for the new access
+// token; the new refresh token keeps the original scope (RFC 6749 section 6).
+func (s *OAuthService) RefreshToken(client *models.OAuthClient, rawToken, scope string) (*OAuthTokenResponse, error) {
+	if rawToken == "" {
+		return nil, ErrOAuthInvalidRequest
+	}
+	stored, err := s.tokenService.FindRefreshToken(rawToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthInvalidGrant
+		}
+		return nil, err
+	}
+	var scopes []string
+	responseScope := stored.Scope
+	if scope != "" {
+		requested, err := utils.ParseScope(scope)
+		if err != nil || !utils.ScopesAllowed(requested, strings.Fields(stored.Scope)) {
+			return nil, ErrOAuthInvalidScope
+		}
+		scopes = requested
+		responseScope = utils.FormatScope(requested)
+	}
+
+	pair, err := s.tokenService.Refresh(rawToken, client.ClientID, scopes)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) ||
+			errors.Is(err, ErrAccountSuspended) || errors.Is(err, ErrAccountDeactivated) {
+			return nil, ErrOAuthInvalidGrant
+		}
+		return nil, err
+	}
+	return tokenResponse(pair, responseScope), nil
+}
+
+// ClientCredentials implements the client_credentials grant for confidential
+// clients. The token acts as the client's owner, limited to the client's scopes.
+func (s *OAuthService) ClientCredentials(client *models.OAuthClient, scope string) (*OAuthTokenResponse, error) {
+	if !client.Confidential {
+		return nil, ErrOAuthUnauthorizedClient
+	}
+	scopes, err := s.grantableScopes(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var owner models.User
+	if err := s.db.First(&owner, client.OwnerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthInvalidClient
+		}
+		return nil, err
+	}
+	// Clients act as their owner, so they stop working while the owner is disabled
+	if CheckAccountStatus(&owner) != nil {
+		return nil, ErrOAuthInvalidClient
+	}
+
+	accessToken, err := s.tokenService.IssueAccessToken(&owner, TokenGrant{Scopes: scopes, ClientID: client.ClientID})
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(utils.AccessTokenTTL().Seconds()),
+		Scope:       utils.FormatScope(scopes),
+	}, nil
+}
+
+// Introspect describes an access or refresh token (RFC 7662). Unknown, expired and
+// revoked tokens are simply inactive.
+func (s *OAuthService) Introspect(rawToken, tokenTypeHint string) (*Introspection, error) {
+	if tokenTypeHint != "refresh_token" {
+		if claims, err := s.tokenService.ValidateAccessToken(rawToken); err == nil {
+			result := &Introspection{
+				Active:    true,
+				Scope:     claims.Scope,
+				ClientID:  claims.ClientID,
+				TokenType: "Bearer",
+				Sub:       strconv.FormatUint(uint64(claims.UserID), 10),
+			}
+			if claims.ExpiresAt != nil {
+				result.Exp = claims.ExpiresAt.Unix()
+			}
+			if claims.IssuedAt != nil {
+				result.Iat = claims.IssuedAt.Unix()
+			}
+			result.Username = s.username(claims.UserID)
+			return result, nil
+		}
+	}
+
+	stored, err := s.tokenService.FindRefreshToken(rawToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &Introspection{Active: false}, nil
+		}
+		return nil, err
+	}
+	if stored.UsedAt != nil || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return &Introspection{Active: false}, nil
+	}
+	return &Introspection{
+		Active:    true,
+		Scope:     stored.Scope,
+		ClientID:  stored.ClientID,
+		TokenType: "refresh_token",
+		Exp:       stored.ExpiresAt.Unix(),
+		Iat:       stored.CreatedAt.Unix(),
+		Sub:       strconv.FormatUint(uint64(stored.UserID), 10),
+		Username:  s.username(stored.UserID),
+	}, nil
+}
+
+// Revoke revokes an access or refresh token issued to the client (RFC 7009).
+// Tokens that are unknown or belong to another client are ignored.
+func (s *OAuthService) Revoke(client *models.OAuthClient, rawToken, tokenTypeHint string) error {
+	if tokenTypeHint != "refresh_token" {
+		if claims, err := s.tokenService.ValidateAccessToken(rawToken); err == nil {
+			if claims.ClientID != client.ClientID {
+				return nil
+			}
+			return s.tokenService.RevokeAccessToken(claims)
+		}
+	}
+
+	stored, err := s.tokenService.FindRefreshToken(rawToken)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.ClientID != client.ClientID {
+		return nil
+	}
+	return s.tokenService.RevokeFamily(stored.FamilyID)
+}
+
+// activeClient loads a client that has not been revoked
+func (s *OAuthService) activeClient(clientID string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrOAuthInvalidClient
+	}
+	var client models.OAuthClient
+	if err := s.db.Where("client_id = ? AND revoked_at IS NULL", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthInvalidClient
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+// grantableScopes validates a requested scope string against the client's
+// registered scopes. An empty request grants all of them.
+func (s *OAuthService) grantableScopes(client *models.OAuthClient, scope string) ([]string, error) {
+	if strings.TrimSpace(scope) == "" {
+		return client.ScopeList(), nil
+	}
+	scopes, err := utils.ParseScope(scope)
+	if err != nil || !utils.ScopesAllowed(scopes, client.ScopeList()) {
+		return nil, ErrOAuthInvalidScope
+	}
+	return scopes, nil
+}
+
+// username returns the username for introspection responses, or "" if unknown
+func (s *OAuthService) username(userID uint) string {
+	var user models.User
+	if err := s.db.Select("id", "username").First(&user, userID).Error; err != nil {
+		return ""
+	}
+	return user.Username
+}
+
+// tokenResponse converts a token pair into the RFC 6749 response format
+func tokenResponse(pair *TokenPair, scope string) *OAuthTokenResponse {
+	return &OAuthTokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        scope,
+	}
+}
+
+// verifyPKCE checks an S256 code verifier against the stored challenge (RFC 7636)
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// validRedirectURI accepts absolute URIs without a fragment
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.IsAbs() && u.Host != "" && u.Fragment == ""
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// oauthCodeTTL returns the configured lifetime of authorization codes
+func oauthCodeTTL() time.Duration {
+	if config.AppConfig.OAuthCodeTTL > 0 {
+		return config.AppConfig.OAuthCodeTTL
+	}
+	return defaultOAuthCodeTTL
+}
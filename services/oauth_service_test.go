@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"gocheck/models"
+	"gocheck/testdb"
+	"gocheck/utils"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// RFC 7636 Appendix B
+const (
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	testRedirectURI   = "https://client.example.com/callback"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		want     bool
+	}{
+		{"RFC 7636 example", testCodeVerifier, true},
+		{"other verifier", strings.Repeat("a", 43), false},
+		{"the challenge itself", testCodeChallenge, false},
+		{"too short", testCodeVerifier[:42], false},
+		{"too long", strings.Repeat("a", 129), false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		if got := verifyPKCE(testCodeChallenge, tt.verifier); got != tt.want {
+			t.Errorf("%s: verifyPKCE = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := map[string]bool{
+		"https://client.example.com/callback": true,
+		"com.example.app://callback":          true,
+		"http://localhost:8080/cb":            true,
+		"/callback":                           false,
+		"https://client.example.com/cb#frag":  false,
+		"not a uri":                           false,
+	}
+	for uri, want := range tests {
+		if got := validRedirectURI(uri); got != want {
+			t.Errorf("validRedirectURI(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
+
+// registerTestClient registers a client for the books scopes owned by a new user
+func registerTestClient(t *testing.T, db *gorm.DB, oauth *OAuthService, confidential bool) (*models.OAuthClient, string) {
+	t.Helper()
+	owner := testdb.CreateUser(t, db, "user")
+	client, secret, err := oauth.RegisterClient(owner.ID, "Test client", []string{testRedirectURI}, []string{"books:read", "books:write"}, confidential)
+	if err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	return client, secret
+}
+
+// authorizeTestCode runs the consent step for the user and returns the code
+func authorizeTestCode(t *testing.T, oauth *OAuthService, client *models.OAuthClient, user *models.User, scope string) string {
+	t.Helper()
+	req := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ClientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+	client, scopes, err := oauth.ValidateAuthorizeRequest(req)
+	if err != nil {
+		t.Fatalf("ValidateAuthorizeRequest: %v", err)
+	}
+	code, err := oauth.IssueAuthorizationCode(client, user.ID, req, scopes)
+	if err != nil {
+		t.Fatalf("IssueAuthorizationCode: %v", err)
+	}
+	return code
+}
+
+func TestAuthenticateClient(t *testing.T) {
+	db := testdb.Open(t)
+	oauth := NewOAuthService(db)
+	confidential, secret := registerTestClient(t, db, oauth, true)
+	public, _ := registerTestClient(t, db, oauth, false)
+
+	tests := []struct {
+		name     string
+		clientID string
+		secret   string
+		ok       bool
+	}{
+		{"confidential with its secret", confidential.ClientID, secret, true},
+		{"confidential with a wrong secret", confidential.ClientID, "wrong", false},
+		{"confidential without a secret", confidential.ClientID, "", false},
+		{"public without a secret", public.ClientID, "", true},
+		{"public with a secret", public.ClientID, secret, false},
+		{"unknown client", "unknown", "", false},
+	}
+	for _, tt := range tests {
+		_, err := oauth.AuthenticateClient(tt.clientID, tt.secret)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrOAuthInvalidClient) {
+			t.Errorf("%s: error = %v, want ErrOAuthInvalidClient", tt.name, err)
+		}
+	}
+}
+
+func TestValidateAuthorizeRequestRequiresPKCE(t *testing.T) {
+	db := testdb.Open(t)
+	oauth := NewOAuthService(db)
+	client, _ := registerTestClient(t, db, oauth, false)
+
+	valid := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ClientID,
+		RedirectURI:         testRedirectURI,
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+	_, scopes, err := oauth.ValidateAuthorizeRequest(valid)
+	if err != nil {
+		t.Fatalf("ValidateAuthorizeRequest: %v", err)
+	}
+	if got := strings.Join(scopes, " "); got != "books:read books:write" {
+		t.Errorf("scopes without a request = %q, want every registered scope", got)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*AuthorizeRequest)
+		want   error
+	}{
+		{"no code challenge", func(r *AuthorizeRequest) { r.CodeChallenge = "" }, ErrOAuthInvalidRequest},
+		{"plain challenge method", func(r *AuthorizeRequest) { r.CodeChallengeMethod = "plain" }, ErrOAuthInvalidRequest},
+		{"implicit grant", func(r *AuthorizeRequest) { r.ResponseType = "token" }, ErrOAuthInvalidRequest},
+		{"unregistered redirect URI", func(r *AuthorizeRequest) { r.RedirectURI = "https://evil.example.com/cb" }, ErrOAuthInvalidRedirectURI},
+		{"unknown client", func(r *AuthorizeRequest) { r.ClientID = "unknown" }, ErrOAuthInvalidRedirectURI},
+		{"scope the client does not have", func(r *AuthorizeRequest) { r.Scope = "users:admin" }, ErrOAuthInvalidScope},
+	}
+	for _, tt := range tests {
+		req := valid
+		tt.modify(&req)
+		if _, _, err := oauth.ValidateAuthorizeRequest(req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	oauth := NewOAuthService(db)
+	client, _ := registerTestClient(t, db, oauth, false)
+	other, _ := registerTestClient(t, db, oauth, false)
+	user := testdb.CreateUser(t, db, "user")
+	code := authorizeTestCode(t, oauth, client, user, "books:read")
+
+	// Failed attempts leave the code usable by the legitimate client
+	failures := []struct {
+		name                        string
+		client                      *models.OAuthClient
+		code, redirectURI, verifier string
+		want                        error
+	}{
+		{"wrong verifier", client, code, testRedirectURI, strings.Repeat("a", 43), ErrOAuthInvalidGrant},
+		{"missing verifier", client, code, testRedirectURI, "", ErrOAuthInvalidRequest},
+		{"other redirect URI", client, code, "https://client.example.com/other", testCodeVerifier, ErrOAuthInvalidGrant},
+		{"other client", other, code, testRedirectURI, testCodeVerifier, ErrOAuthInvalidGrant},
+		{"unknown code", client, "unknown", testRedirectURI, testCodeVerifier, ErrOAuthInvalidGrant},
+	}
+	for _, tt := range failures {
+		if _, err := oauth.ExchangeAuthorizationCode(tt.client, tt.code, tt.redirectURI, tt.verifier); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	response, err := oauth.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatalf("ExchangeAuthorizationCode: %v", err)
+	}
+	if response.Scope != "books:read" || response.RefreshToken == "" || response.TokenType != "Bearer" {
+		t.Errorf("token response = %+v", response)
+	}
+	claims, err := oauth.tokenService.ValidateAccessToken(response.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.UserID != user.ID || claims.ClientID != client.ClientID || claims.Scope != "books:read" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+
+	// Codes are single-use
+	if _, err := oauth.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Errorf("second exchange error = %v, want ErrOAuthInvalidGrant", err)
+	}
+}
+
+func TestOAuthRefreshIsBoundToClient(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	oauth := NewOAuthService(db)
+	client, _ := registerTestClient(t, db, oauth, false)
+	other, _ := registerTestClient(t, db, oauth, false)
+	user := testdb.CreateUser(t, db, "user")
+
+	code := authorizeTestCode(t, oauth, client, user, "books:read books:write")
+	issued, err := oauth.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatalf("ExchangeAuthorizationCode: %v", err)
+	}
+
+	if _, err := oauth.RefreshToken(other, issued.RefreshToken, ""); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Errorf("refresh by another client error = %v, want ErrOAuthInvalidGrant", err)
+	}
+	if _, err := oauth.RefreshToken(client, issued.RefreshToken, "users:admin"); !errors.Is(err, ErrOAuthInvalidScope) {
+		t.Errorf("refresh with a wider scope error = %v, want ErrOAuthInvalidScope", err)
+	}
+
+	refreshed, err := oauth.RefreshToken(client, issued.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if refreshed.Scope != "books:read books:write" || refreshed.RefreshToken == issued.RefreshToken {
+		t.Errorf("refreshed response = %+v", refreshed)
+	}
+
+	// A narrower scope limits the access token; the refresh token keeps the grant
+	narrowed, err := oauth.RefreshToken(client, refreshed.RefreshToken, "books:read")
+	if err != nil {
+		t.Fatalf("RefreshToken with a narrower scope: %v", err)
+	}
+	claims, err := utils.ValidateToken(narrowed.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if narrowed.Scope != "books:read" || claims.Scope != "books:read" {
+		t.Errorf("narrowed scope = %q, claim %q, want books:read", narrowed.Scope, claims.Scope)
+	}
+	widened, err := oauth.RefreshToken(client, narrowed.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("RefreshToken after narrowing: %v", err)
+	}
+	if widened.Scope != "books:read books:write" {
+		t.Errorf("scope after narrowing = %q, want the original grant", widened.Scope)
+	}
+}
+
+func TestRevokeClientRevokesRefreshTokens(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	oauth := NewOAuthService(db)
+	client, _ := registerTestClient(t, db, oauth, false)
+	user := testdb.CreateUser(t, db, "user")
+
+	code := authorizeTestCode(t, oauth, client, user, "")
+	issued, err := oauth.ExchangeAuthorizationCode(client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatalf("ExchangeAuthorizationCode: %v", err)
+	}
+	if err := oauth.RevokeClient(client.OwnerID, client.ID); err != nil {
+		t.Fatalf("RevokeClient: %v", err)
+	}
+
+	if _, err := oauth.AuthenticateClient(client.ClientID, ""); !errors.Is(err, ErrOAuthInvalidClient) {
+		t.Errorf("revoked client authenticated: %v", err)
+	}
+	if _, err := oauth.RefreshToken(client, issued.RefreshToken, ""); !errors.Is(err, ErrOAuthInvalidGrant) {
+		t.Errorf("refresh after RevokeClient error = %v, want ErrOAuthInvalidGrant", err)
+	}
+}
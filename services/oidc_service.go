@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/oidc"
+	"gocheck/utils"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOIDCDisabled is returned when no OpenID Connect provider is configured
+	ErrOIDCDisabled = errors.New("OpenID Connect login is not configured")
+	// ErrOIDCInvalidState is returned when the callback does not belong to a login started by this browser
+	ErrOIDCInvalidState = errors.New("invalid or expired OpenID Connect login state")
+	// ErrOIDCAccountExists is returned when the provider's email belongs to a local
+	// user that may not be linked automatically
+	ErrOIDCAccountExists = errors.New("an account with this email already exists")
+	// ErrOIDCNotProvisioned is returned for unknown identities when auto-provisioning is off
+	ErrOIDCNotProvisioned = errors.New("no account is linked to this identity")
+	// ErrOIDCEmailRequired is returned when a user must be provisioned but the provider sent no email
+	ErrOIDCEmailRequired = errors.New("identity provider did not supply an email address")
+	// ErrOIDCInvitationRequired is returned when registration is closed and the
+	// provider's verified email has no pending sign-up invitation
+	ErrOIDCInvitationRequired = errors.New("registration requires an invitation")
+)
+
+// OIDCLoginTTL is the time allowed between starting an OIDC login and the callback
+const OIDCLoginTTL = 10 * time.Minute
+
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// OIDCService signs users in through the configured OpenID Connect provider,
+// provisioning or linking local accounts as needed
+type OIDCService struct {
+	db       *gorm.DB
+	provider *oidc.Provider
+}
+
+// NewOIDCService creates an OIDCService for the provider in config.AppConfig.OIDC.
+// The provider is nil, and every login fails with ErrOIDCDisabled, when none is configured.
+func NewOIDCService(db *gorm.DB) *OIDCService {
+	cfg := config.AppConfig.OIDC
+	s := &OIDCService{db: db}
+	if cfg.Issuer != "" {
+		s.provider = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		}, nil)
+	}
+	return s
+}
+
+// BeginLogin returns the provider URL to send the user to and a state token the
+// caller must keep in the browser (e.g. a cookie) until the callback
+func (s *OIDCService) BeginLogin(ctx context.Context) (authURL, stateToken string, err error) {
+	if s.provider == nil {
+		return "", "", ErrOIDCDisabled
+	}
+
+	state, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := utils.GenerateRandomToken(48)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authURL, err = s.provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+	stateToken, err = utils.GenerateOIDCStateToken(state, nonce, verifier, OIDCLoginTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, stateToken, nil
+}
+
+// CompleteLogin handles the provider callback: it checks the state against the
+// browser's state token, redeems the code, verifies the ID token and returns the
+// local user, creating or linking one if necessary
+func (s *OIDCService) CompleteLogin(ctx context.Context, stateToken, state, code string) (*models.User, error) {
+	if s.provider == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	pending, err := utils.ValidateOIDCStateToken(stateToken)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(pending.State), []byte(state)) != 1 {
+		return nil, ErrOIDCInvalidState
+	}
+
+	claims, err := s.provider.Exchange(ctx, code, pending.CodeVerifier, pending.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.ResolveUser(claims)
+}
+
+// ResolveUser maps verified ID token claims to a local user. Known identities sign
+// in their linked user; otherwise a user with the same email is linked when the
+// provider verified that email, and failing that a new user is provisioned. While
+// OPEN_REGISTRATION is off, provisioning uses up a pending sign-up invitation for
+// the verified email, whose role the new user gets.
+func (s *OIDCService) ResolveUser(claims *oidc.IDTokenClaims) (*models.User, error) {
+	cfg := config.AppConfig.OIDC
+	issuer := claims.Issuer
+	email := strings.TrimSpace(claims.Email)
+	now := time.Now()
+
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&identity).Updates(map[string]interface{}{"email": email, "last_login_at": now}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if email != "" {
+			err := tx.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+			if err == nil {
+				// Only an address the provider vouches for may take over a local account
+				if !cfg.LinkExisting || !claims.EmailVerified {
+					return ErrOIDCAccountExists
+				}
+				log.Printf("Linking OIDC identity %s/%s to existing user %d", issuer, claims.Subject, user.ID)
+				return createIdentity(tx, user.ID, issuer, claims.Subject, email, now)
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if !cfg.AutoProvision {
+			return ErrOIDCNotProvisioned
+		}
+		if email == "" {
+			return ErrOIDCEmailRequired
+		}
+
+		role := cfg.DefaultRole
+		var invitation *models.Invitation
+		if !config.AppConfig.OpenRegistration {
+			// The provider must vouch for the address, or anyone could claim an invited email
+			if !claims.EmailVerified {
+				return ErrOIDCInvitationRequired
+			}
+			invitation, err = pendingSignupInvitation(tx, email)
+			if err != nil {
+				if errors.Is(err, ErrInvalidInvitation) {
+					return ErrOIDCInvitationRequired
+				}
+				return err
+			}
+			role = invitation.UserRole
+		}
+
+		if err := provisionUser(tx, &user, claims, email, role); err != nil {
+			return err
+		}
+		if invitation != nil {
+			if err := markInvitationAccepted(tx, invitation, user.ID); err != nil {
+				return err
+			}
+		}
+		return createIdentity(tx, user.ID, issuer, claims.Subject, email, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckAccountStatus(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// provisionUser creates a local user for a first-time OIDC login. The account gets
+// an unusable random password; it can sign in through the provider or set a
+// password with the reset flow.
+func provisionUser(tx *gorm.DB, user *models.User, claims *oidc.IDTokenClaims, email, role string) error {
+	randomPassword, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+	username, err := availableUsername(tx, claims, email)
+	if err != nil {
+		return err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		parts := strings.Fields(claims.Name)
+		if len(parts) > 0 {
+			firstName, lastName = parts[0], strings.Join(parts[1:], " ")
+		}
+	}
+
+	*user = models.User{
+		Name:          &models.Name{FirstName: firstName, LastName: lastName},
+		Username:      username,
+		Email:         email,
+		Role:          role,
+		Password:      hashedPassword,
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return tx.Create(user).Error
+}
+
+// availableUsername derives a username from the provider's claims, adding a
+// numeric suffix when it is already taken
+func availableUsername(tx *gorm.DB, claims *oidc.IDTokenClaims, email string) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(email, "@", 2)[0]
+	}
+	base = usernameCleaner.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+
+	suffix, err := utils.GenerateRandomToken(4)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + usernameCleaner.ReplaceAllString(suffix, ""), nil
+}
+
+func createIdentity(tx *gorm.DB, userID uint, issuer, subject, email string, now time.Time) error {
+	identity := models.UserIdentity{
+		UserID:      userID,
+		Issuer:      issuer,
+		Subject:     subject,
+		Email:       email,
+		LastLoginAt: &now,
+	}
+	return tx.Create(&identity).Error
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"errors"
+	"gocheck/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrganizationSlugTaken is returned when another organization already uses the slug
+	ErrOrganizationSlugTaken = errors.New("organization slug already in use")
+	// ErrOrganizationNotEmpty is returned when deleting an organization that still has members or books
+	ErrOrganizationNotEmpty = errors.New("organization still has members or books")
+	// ErrInvalidOrgRole is returned for a role other than owner, admin or member
+	ErrInvalidOrgRole = errors.New("invalid organization role")
+	// ErrLastOwner is returned when a change would leave an organization without an owner
+	ErrLastOwner = errors.New("organization must keep at least one owner")
+	// ErrNotMember is returned when a role change targets a user outside the organization
+	ErrNotMember = errors.New("user is not a member of the organization")
+)
+
+// OrganizationMember describes a member of an organization
+type OrganizationMember struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// OrganizationService manages organizations and their memberships
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+// NewOrganizationService creates a new OrganizationService
+func NewOrganizationService(db *gorm.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+// CreateOrganization creates an organization. When ownerID is non-zero that user
+// becomes its first owner.
+func (s *OrganizationService) CreateOrganization(name, slug string, ownerID uint) (*models.Organization, error) {
+	org := models.Organization{Name: name, Slug: strings.ToLower(slug)}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSlugAvailable(tx, org.Slug, 0); err != nil {
+			return err
+		}
+		if ownerID != 0 {
+			if err := tx.Select("id").First(&models.User{}, ownerID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		if ownerID == 0 {
+			return nil
+		}
+		return tx.Create(&models.OrganizationMembership{OrganizationID: org.ID, UserID: ownerID, Role: models.OrgRoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ListOrganizations returns every organization
+func (s *OrganizationService) ListOrganizations() ([]models.Organization, error) {
+	var orgs []models.Organization
+	if err := s.db.Order("name").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// GetOrganization returns a single organization
+func (s *OrganizationService) GetOrganization(id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := s.db.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// UpdateOrganization renames an organization
+func (s *OrganizationService) UpdateOrganization(id uint, name, slug string) (*models.Organization, error) {
+	var org models.Organization
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&org, id).Error; err != nil {
+			return err
+		}
+		org.Name = name
+		org.Slug = strings.ToLower(slug)
+		if err := checkSlugAvailable(tx, org.Slug, org.ID); err != nil {
+			return err
+		}
+		return tx.Save(&org).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// DeleteOrganization deletes an empty organization and its pending invitations.
+// Members and books have to be removed first so no data changes tenant silently.
+func (s *OrganizationService) DeleteOrganization(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var org models.Organization
+		if err := tx.First(&org, id).Error; err != nil {
+			return err
+		}
+		var members, books int64
+		if err := tx.Model(&models.OrganizationMembership{}).Where("organization_id = ?", id).Count(&members).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Book{}).Where("org_id = ?", id).Count(&books).Error; err != nil {
+			return err
+		}
+		if members > 0 || books > 0 {
+			return ErrOrganizationNotEmpty
+		}
+		return tx.Delete(&org).Error
+	})
+}
+
+// ListMembers returns the members of an organization
+func (s *OrganizationService) ListMembers(orgID uint) ([]OrganizationMember, error) {
+	var members []OrganizationMember
+	err := s.db.Model(&models.OrganizationMembership{}).
+		Select("organization_memberships.user_id, users.username, users.email, organization_memberships.role").
+		Joins("JOIN users ON users.id = organization_memberships.user_id").
+		Where("organization_memberships.organization_id = ?", orgID).
+		Order("users.username").
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SetMemberRole changes a member's role in an organization. With addMissing set it
+// also adds a user who is not a member yet; otherwise that returns ErrNotMember.
+func (s *OrganizationService) SetMemberRole(orgID, userID uint, role string, addMissing bool) (*models.OrganizationMembership, error) {
+	if !models.IsOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+	var membership models.OrganizationMembership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Organization{}, orgID).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&models.User{}, userID).Error; err != nil {
+			return err
+		}
+		err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !addMissing {
+				return ErrNotMember
+			}
+			membership = models.OrganizationMembership{OrganizationID: orgID, UserID: userID, Role: role}
+			return tx.Create(&membership).Error
+		}
+		if err != nil {
+			return err
+		}
+		if membership.Role == models.OrgRoleOwner && role != models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		membership.Role = role
+		return tx.Save(&membership).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// RemoveMember removes a user from an organization. Their books stay with the organization.
+func (s *OrganizationService) RemoveMember(orgID, userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var membership models.OrganizationMembership
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+			return err
+		}
+		if membership.Role == models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&membership).Error
+	})
+}
+
+// ListMemberships returns the organizations a user belongs to
+func (s *OrganizationService) ListMemberships(userID uint) ([]models.OrganizationMembership, error) {
+	var memberships []models.OrganizationMembership
+	if err := s.db.Preload("Organization").Where("user_id = ?", userID).Order("id").Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	return memberships, nil
+}
+
+// Membership returns the user's membership of an organization
+func (s *OrganizationService) Membership(orgID, userID uint) (*models.OrganizationMembership, error) {
+	var membership models.OrganizationMembership
+	if err := s.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// resolveOrganization picks the organization a token is confined to: the
+// requested one if the user is a member of it, otherwise the organization they
+// joined first, or 0 when they belong to none
+func resolveOrganization(db *gorm.DB, userID, requested uint) (uint, error) {
+	if requested != 0 {
+		var count int64
+		if err := db.Model(&models.OrganizationMembership{}).Where("organization_id = ? AND user_id = ?", requested, userID).Count(&count).Error; err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			return requested, nil
+		}
+	}
+	var membership models.OrganizationMembership
+	if err := db.Where("user_id = ?", userID).Order("id").Limit(1).Find(&membership).Error; err != nil {
+		return 0, err
+	}
+	return membership.OrganizationID, nil
+}
+
+// checkSlugAvailable fails with ErrOrganizationSlugTaken if another organization uses slug
+func checkSlugAvailable(tx *gorm.DB, slug string, exceptID uint) error {
+	var count int64
+	if err := tx.Model(&models.Organization{}).Where("slug = ? AND id <> ?", slug, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrOrganizationSlugTaken
+	}
+	return nil
+}
+
+// ensureAnotherOwner fails with ErrLastOwner unless the organization has an owner besides userID
+func ensureAnotherOwner(tx *gorm.DB, orgID, userID uint) error {
+	var owners int64
+	err := tx.Model(&models.OrganizationMembership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, models.OrgRoleOwner, userID).
+		Count(&owners).Error
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
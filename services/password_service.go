@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"gocheck/mailer"
+	"gocheck/models"
+	"gocheck/utils"
+	"log"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidResetToken is returned for unknown, expired or already used reset tokens
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// defaultPasswordResetTTL is used when the configuration does not provide a lifetime
+const defaultPasswordResetTTL = time.Hour
+
+// PasswordService handles password recovery
+type PasswordService struct {
+	db           *gorm.DB
+	mailer       mailer.Mailer
+	tokenService *TokenService
+}
+
+// NewPasswordService creates a new PasswordService
+func NewPasswordService(db *gorm.DB, m mailer.Mailer) *PasswordService {
+	return &PasswordService{db: db, mailer: m, tokenService: NewTokenService(db)}
+}
+
+// RequestReset emails a reset token to the user with the given address. Unknown
+// addresses are ignored without error so callers cannot probe for accounts.
+// It takes noticeably longer for registered addresses, so request handlers
+// should run it after responding.
+func (s *PasswordService) RequestReset(email string) error {
+	var user models.User
+	if err := s.db.Where("email = ?", email).Limit(1).Find(&user).Error; err != nil {
+		return err
+	}
+	if user.ID == 0 {
+		return nil
+	}
+
+	rawToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Only the most recently requested link stays valid
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		resetToken := models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(rawToken),
+			ExpiresAt: time.Now().Add(passwordResetTTL()),
+		}
+		return tx.Create(&resetToken).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    passwordResetBody(user.Username, rawToken),
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		return err
+	}
+	return nil
+}
+
+// ResetPassword consumes a reset token and sets the user's new password.
+// All existing sessions of the user are revoked afterwards.
+func (s *PasswordService) ResetPassword(rawToken, newPassword string) error {
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var resetToken models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", utils.HashToken(rawToken)).First(&resetToken).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		var user models.User
+		if err := tx.First(&user, resetToken.UserID).Error; err != nil {
+			return err
+		}
+		// A policy violation leaves the token unused so the user can try again
+		if err := utils.ValidatePassword(newPassword, user.Username, user.Email); err != nil {
+			return err
+		}
+		hashedPassword, err := utils.HashPassword(newPassword)
+		if err != nil {
+			return errors.New("failed to hash password")
+		}
+
+		// Conditional update so the token cannot be consumed twice concurrently
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		userID = user.ID
+		return tx.Model(&user).Update("password", hashedPassword).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.tokenService.RevokeAllForUser(userID)
+}
+
+// passwordResetBody words the reset email. With PASSWORD_RESET_URL set it links
+// to that page; otherwise it explains how to redeem the token against the API.
+func passwordResetBody(username, rawToken string) string {
+	if config.AppConfig.PasswordResetURL != "" {
+		link, err := url.Parse(config.AppConfig.PasswordResetURL)
+		if err == nil {
+			query := link.Query()
+			query.Set("token", rawToken)
+			link.RawQuery = query.Encode()
+			return fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not request this, you can ignore this email.",
+				username, passwordResetTTL(), link)
+		}
+	}
+	return fmt.Sprintf("Hi %s,\n\nTo choose a new password, send POST %s/password/reset with this token and your new password. The token expires in %s and can only be used once.\n\n%s\n\nIf you did not request this, you can ignore this email.",
+		username, config.AppConfig.BaseURL, passwordResetTTL(), rawToken)
+}
+
+// passwordResetTTL returns the configured lifetime of reset tokens
+func passwordResetTTL() time.Duration {
+	if config.AppConfig.PasswordResetTTL > 0 {
+		return config.AppConfig.PasswordResetTTL
+	}
+	return defaultPasswordResetTTL
+}
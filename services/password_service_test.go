@@ -0,0 +1,30 @@
+package services
+
+import (
+	"gocheck/config"
+	"strings"
+	"testing"
+)
+
+func TestPasswordResetBody(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.BaseURL = "https://api.example.com"
+
+	config.AppConfig.PasswordResetURL = ""
+	body := passwordResetBody("alice", "tok+en")
+	for _, want := range []string{"POST https://api.example.com/password/reset", "\n\ntok+en\n\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body without PASSWORD_RESET_URL is missing %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "?token=") {
+		t.Errorf("body without PASSWORD_RESET_URL links to a page the API does not serve:\n%s", body)
+	}
+
+	config.AppConfig.PasswordResetURL = "https://app.example.com/reset?lang=en"
+	body = passwordResetBody("alice", "tok+en")
+	if !strings.Contains(body, "https://app.example.com/reset?lang=en&token=tok%2Ben") {
+		t.Errorf("body does not link to PASSWORD_RESET_URL with the token:\n%s", body)
+	}
+}
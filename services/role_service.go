@@ -0,0 +1,234 @@
+package services
+
+import (
+	"errors"
+	"gocheck/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUnknownPermission is returned when a role references a permission that does not exist
+	ErrUnknownPermission = errors.New("unknown permission")
+	// ErrProtectedRole is returned when deleting or renaming a built-in role that accounts depend on
+	ErrProtectedRole = errors.New("built-in role cannot be deleted or renamed")
+	// ErrRoleInUse is returned when deleting or renaming a role that is still some user's primary role
+	ErrRoleInUse = errors.New("role is still the primary role of a user")
+)
+
+// protectedRoles are referenced by models.User.Role and must always exist
+var protectedRoles = map[string]bool{"admin": true, "user": true}
+
+// RoleService provides business logic for roles and permissions
+type RoleService struct {
+	db *gorm.DB
+}
+
+// NewRoleService creates a new RoleService
+func NewRoleService(db *gorm.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+// ListRoles returns every role with its permissions
+func (s *RoleService) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	if err := s.db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetRoleByID returns a single role with its permissions
+func (s *RoleService) GetRoleByID(id uint) (*models.Role, error) {
+	var role models.Role
+	if err := s.db.Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListPermissions returns the permission catalogue
+func (s *RoleService) ListPermissions() ([]models.Permission, error) {
+	var perms []models.Permission
+	if err := s.db.Order("name").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// CreateRole creates a role granting the named permissions
+func (s *RoleService) CreateRole(name, description string, permissionNames []string) (*models.Role, error) {
+	role := models.Role{Name: name, Description: description}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		perms, err := findPermissions(tx, permissionNames)
+		if err != nil {
+			return err
+		}
+		role.Permissions = perms
+		return tx.Create(&role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole renames a role and replaces its permissions
+func (s *RoleService) UpdateRole(id uint, name, description string, permissionNames []string) (*models.Role, error) {
+	var role models.Role
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&role, id).Error; err != nil {
+			return err
+		}
+		if name != role.Name {
+			if protectedRoles[role.Name] {
+				return ErrProtectedRole
+			}
+			// users.role holds the name, so renaming would silently strip the role from its holders
+			if err := ensureRoleUnused(tx, role.Name); err != nil {
+				return err
+			}
+		}
+
+		perms, err := findPermissions(tx, permissionNames)
+		if err != nil {
+			return err
+		}
+
+		role.Name = name
+		role.Description = description
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Replace(perms); err != nil {
+			return err
+		}
+		role.Permissions = perms
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteRole deletes a role and removes it from every user holding it as an
+// additional role. A role that is still some user's primary role is kept.
+func (s *RoleService) DeleteRole(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.First(&role, id).Error; err != nil {
+			return err
+		}
+		if protectedRoles[role.Name] {
+			return ErrProtectedRole
+		}
+		if err := ensureRoleUnused(tx, role.Name); err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+}
+
+// SetUserRoles replaces the additional roles assigned to a user
+func (s *RoleService) SetUserRoles(userID uint, roleIDs []uint) (*models.User, error) {
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var roles []models.Role
+		if len(roleIDs) > 0 {
+			if err := tx.Where("id IN ?", roleIDs).Find(&roles).Error; err != nil {
+				return err
+			}
+			if len(roles) != len(uniqueIDs(roleIDs)) {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		user.Roles = roles
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PermissionsForUser returns the union of permissions granted by the user's
+// primary role and any additional roles
+func (s *RoleService) PermissionsForUser(userID uint) (map[string]bool, error) {
+	var names []string
+	err := s.db.Model(&models.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.id IN (?) OR roles.name = (?)",
+			s.db.Table("user_roles").Select("role_id").Where("user_id = ?", userID),
+			s.db.Model(&models.User{}).Select("role").Where("id = ?", userID),
+		).
+		Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string]bool, len(names))
+	for _, name := range names {
+		perms[name] = true
+	}
+	return perms, nil
+}
+
+// ensureRoleUnused fails with ErrRoleInUse while any user has the named role as
+// their primary role
+func ensureRoleUnused(tx *gorm.DB, name string) error {
+	var count int64
+	if err := tx.Model(&models.User{}).Where("role = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	return nil
+}
+
+// findPermissions loads permissions by name, failing if any is unknown
+func findPermissions(tx *gorm.DB, names []string) ([]models.Permission, error) {
+	var perms []models.Permission
+	if len(names) == 0 {
+		return perms, nil
+	}
+	if err := tx.Where("name IN ?", names).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	if len(perms) != len(uniqueStrings(names)) {
+		return nil, ErrUnknownPermission
+	}
+	return perms, nil
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func uniqueStrings(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
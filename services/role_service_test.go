@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"gocheck/testdb"
+	"testing"
+)
+
+func TestRoleInUseCannotBeRenamedOrDeleted(t *testing.T) {
+	db := testdb.Open(t)
+	svc := NewRoleService(db)
+
+	role, err := svc.CreateRole("auditor", "Reads audit events", nil)
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	holder := testdb.CreateUser(t, db, role.Name)
+
+	if _, err := svc.UpdateRole(role.ID, "reviewer", "", nil); !errors.Is(err, ErrRoleInUse) {
+		t.Errorf("renaming a primary role in use: err = %v, want ErrRoleInUse", err)
+	}
+	if err := svc.DeleteRole(role.ID); !errors.Is(err, ErrRoleInUse) {
+		t.Errorf("deleting a primary role in use: err = %v, want ErrRoleInUse", err)
+	}
+	// Keeping the name only changes the description and permissions
+	if _, err := svc.UpdateRole(role.ID, role.Name, "Reads everything", nil); err != nil {
+		t.Errorf("updating a role in use without renaming it: %v", err)
+	}
+
+	if err := db.Model(holder).Update("role", "user").Error; err != nil {
+		t.Fatalf("reassign user: %v", err)
+	}
+	if _, err := svc.UpdateRole(role.ID, "reviewer", "", nil); err != nil {
+		t.Errorf("renaming an unused role: %v", err)
+	}
+	if err := svc.DeleteRole(role.ID); err != nil {
+		t.Errorf("deleting an unused role: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"gocheck/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is written,
+// so busy clients do not cause a database write on every request
+const sessionTouchInterval = time.Minute
+
+// SessionService lists and revokes a user's login sessions. Sessions are
+// started by TokenService.StartSession.
+type SessionService struct {
+	db *gorm.DB
+}
+
+// NewSessionService creates a new SessionService
+func NewSessionService(db *gorm.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *SessionService) ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's devices out: the session's access tokens
+// stop being accepted and its refresh tokens are revoked. Sessions of other users
+// are reported as not found.
+func (s *SessionService) RevokeSession(userID uint, sessionID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("session_id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// Touch records that the session was just used from ip. Writes are skipped
+// while the last-seen time is less than sessionTouchInterval old.
+func (s *SessionService) Touch(sessionID, ip string) error {
+	now := time.Now()
+	return s.db.Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionID, now.Add(-sessionTouchInterval)).
+		Updates(map[string]interface{}{"last_seen_at": now, "ip": ip}).Error
+}
@@ -0,0 +1,25 @@
+package services
+
+import "gorm.io/gorm"
+
+// Tenant scoping: services given an organization with WithTenant confine every
+// query to it. Organization 0 is the namespace of users outside any organization,
+// so a tenant-scoped service never sees data of a real organization it is not in.
+
+// bookTenantScope limits book queries to one organization
+func bookTenantScope(orgID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("books.org_id = ?", orgID)
+	}
+}
+
+// userTenantScope limits user queries to members of one organization, or to
+// users without any membership for organization 0
+func userTenantScope(orgID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if orgID == 0 {
+			return db.Where("users.id NOT IN (?)", db.Session(&gorm.Session{NewDB: true}).Table("organization_memberships").Select("user_id"))
+		}
+		return db.Where("users.id IN (?)", db.Session(&gorm.Session{NewDB: true}).Table("organization_memberships").Select("user_id").Where("organization_id = ?", orgID))
+	}
+}
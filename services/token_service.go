@@ -0,0 +1,451 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/utils"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already-rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrTokenRevoked is returned for access tokens that were revoked before they expired
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// Defaults used when the configuration does not provide a lifetime
+const (
+	defaultRefreshTokenTTL  = 30 * 24 * time.Hour
+	defaultImpersonationTTL = 15 * time.Minute
+)
+
+// TokenPair is the access/refresh token combination handed back to clients
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Access token lifetime in seconds
+}
+
+// TokenGrant describes properties of a login that every token issued for it
+// carries, including tokens obtained later through refresh.
+type TokenGrant struct {
+	MFA      bool     // The login completed a second factor
+	Scopes   []string // Scopes the tokens are limited to; nil means unrestricted
+	ClientID string   // OAuth2 client the tokens are issued to; empty for first-party logins
+	// Organization the tokens are confined to. 0, or one the user no longer
+	// belongs to, selects the user's default organization.
+	OrgID uint
+	// SessionID binds the tokens to a login session, see StartSession. Empty
+	// for tokens outside any session, e.g. those of OAuth2 clients.
+	SessionID string
+	// AccessScopes limits the access token below Scopes while the refresh token
+	// keeps Scopes, as when an OAuth2 refresh requests a narrower scope. Nil
+	// gives the access token Scopes.
+	AccessScopes []string
+}
+
+// TokenService issues access tokens and manages rotating refresh tokens
+type TokenService struct {
+	db *gorm.DB
+}
+
+// NewTokenService creates a new TokenService
+func NewTokenService(db *gorm.DB) *TokenService {
+	return &TokenService{db: db}
+}
+
+// IssueTokenPair creates an access token and starts a new refresh token family for the user
+func (s *TokenService) IssueTokenPair(user *models.User, grant TokenGrant) (*TokenPair, error) {
+	familyID, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(s.db, user, familyID, grant)
+}
+
+// StartSession records a new login session for the device described by
+// userAgent and ip and issues the first token pair bound to it
+func (s *TokenService) StartSession(user *models.User, grant TokenGrant, userAgent, ip string) (*TokenPair, error) {
+	sessionID, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	familyID, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	var pair *TokenPair
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		session := models.Session{
+			ID:          sessionID,
+			UserID:      user.ID,
+			DeviceLabel: utils.DeviceLabel(userAgent),
+			UserAgent:   userAgent,
+			IP:          ip,
+			LastSeenAt:  now,
+			ExpiresAt:   now.Add(refreshTokenTTL()),
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		grant.SessionID = sessionID
+		var err error
+		pair, err = s.issue(tx, user, familyID, grant)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token is
+// marked as used; presenting it a second time revokes every token in its family.
+// clientID must match the OAuth2 client the family was issued to ("" for first-party).
+// Non-nil scopes limit the new access token; the caller checks they were granted.
+func (s *TokenService) Refresh(rawToken, clientID string, scopes []string) (*TokenPair, error) {
+	var stored models.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		if err := s.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var pair *TokenPair
+	reused := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Conditional update so two concurrent refreshes cannot both succeed
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		var user models.User
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if err := CheckAccountStatus(&user); err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = s.issue(tx, &user, stored.FamilyID, TokenGrant{MFA: stored.MFA, Scopes: strings.Fields(stored.Scope), ClientID: stored.ClientID, OrgID: stored.OrgID, SessionID: stored.SessionID, AccessScopes: scopes})
+		return err
+	})
+	if reused {
+		if err := s.RevokeFamily(stored.FamilyID); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeFamily revokes every outstanding refresh token in a family
+func (s *TokenService) RevokeFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeRefreshToken revokes the family of the given raw refresh token, if it belongs to userID
+func (s *TokenService) RevokeRefreshToken(userID uint, rawToken string) error {
+	var stored models.RefreshToken
+	if err := s.db.Where("token_hash = ? AND user_id = ?", utils.HashToken(rawToken), userID).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return s.RevokeFamily(stored.FamilyID)
+}
+
+// ValidateAccessToken verifies the signature and expiry of an access token and
+// checks it against the revocation denylist, its login session, the user's
+// "log out everywhere" cutoff and their account status.
+func (s *TokenService) ValidateAccessToken(tokenString string) (*utils.Claims, error) {
+	claims, err := utils.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked int64
+	if err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked).Error; err != nil {
+		return nil, err
+	}
+	if revoked > 0 {
+		return nil, ErrTokenRevoked
+	}
+
+	// Signing a device out revokes its session and with it every token of the login;
+	// a session also ends once its last refresh token has expired
+	if claims.SessionID != "" {
+		var active int64
+		if err := s.db.Model(&models.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", claims.SessionID, claims.UserID, time.Now()).
+			Count(&active).Error; err != nil {
+			return nil, err
+		}
+		if active == 0 {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	var user models.User
+	if err := s.db.Select("id", "tokens_valid_after", "status", "suspended_until").First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTokenRevoked
+		}
+		return nil, err
+	}
+	if user.TokensValidAfter != nil && claims.IssuedAt != nil && claims.IssuedAt.Before(*user.TokensValidAfter) {
+		return nil, ErrTokenRevoked
+	}
+	// Suspending or deactivating an account stops its outstanding tokens
+	if err := CheckAccountStatus(&user); err != nil {
+		return nil, err
+	}
+
+	// Impersonation tokens also die when the impersonating admin logs out everywhere or is disabled
+	if claims.Act != nil {
+		var actor models.User
+		if err := s.db.Select("id", "tokens_valid_after", "status", "suspended_until").First(&actor, claims.Act.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrTokenRevoked
+			}
+			return nil, err
+		}
+		if actor.TokensValidAfter != nil && claims.IssuedAt != nil && claims.IssuedAt.Before(*actor.TokensValidAfter) {
+			return nil, ErrTokenRevoked
+		}
+		if CheckAccountStatus(&actor) != nil {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	// Tokens of a revoked OAuth2 client stop working immediately
+	if claims.ClientID != "" {
+		var active int64
+		if err := s.db.Model(&models.OAuthClient{}).Where("client_id = ? AND revoked_at IS NULL", claims.ClientID).Count(&active).Error; err != nil {
+			return nil, err
+		}
+		if active == 0 {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// RevokeAccessToken adds a single access token to the denylist until it expires
+func (s *TokenService) RevokeAccessToken(claims *utils.Claims) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti")
+	}
+	expiresAt := time.Now().Add(utils.AccessTokenTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	entry := models.RevokedToken{JTI: claims.ID, UserID: claims.UserID, ExpiresAt: expiresAt}
+	return s.db.Where(models.RevokedToken{JTI: claims.ID}).FirstOrCreate(&entry).Error
+}
+
+// RevokeAllForUser invalidates every access token issued to the user up to now
+// and revokes all of their refresh tokens and sessions.
+func (s *TokenService) RevokeAllForUser(userID uint) error {
+	cutoff := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("tokens_valid_after", cutoff).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", cutoff).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// PurgeExpired removes denylist entries, refresh tokens, sessions and authorization codes that can no longer be used
+func (s *TokenService) PurgeExpired() error {
+	now := time.Now()
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error; err != nil {
+		return err
+	}
+	if err := s.db.Where("expires_at < ?", now).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at < ?", now).Delete(&models.OAuthAuthorizationCode{}).Error
+}
+
+// StartCleanup periodically purges expired revocation data. It blocks, so run it in a goroutine.
+func (s *TokenService) StartCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.PurgeExpired(); err != nil {
+			log.Printf("Token cleanup failed: %v", err)
+		}
+	}
+}
+
+// IssueAccessToken signs an access token without a refresh token, e.g. for the
+// OAuth2 client_credentials grant
+func (s *TokenService) IssueAccessToken(user *models.User, grant TokenGrant) (string, error) {
+	orgID, err := resolveOrganization(s.db, user.ID, grant.OrgID)
+	if err != nil {
+		return "", err
+	}
+	grant.OrgID = orgID
+	return signAccessToken(user, grant)
+}
+
+// signAccessToken signs an access token for a grant whose organization is already resolved
+func signAccessToken(user *models.User, grant TokenGrant) (string, error) {
+	return utils.GenerateAccessToken(&utils.Claims{
+		UserID:    user.ID,
+		Role:      user.Role,
+		MFA:       grant.MFA,
+		Scope:     utils.FormatScope(grant.Scopes),
+		ClientID:  grant.ClientID,
+		OrgID:     grant.OrgID,
+		SessionID: grant.SessionID,
+	})
+}
+
+// IssueImpersonationToken signs a short-lived, non-refreshable access token for
+// target that names actor in its "act" claim
+func (s *TokenService) IssueImpersonationToken(target, actor *models.User) (string, error) {
+	orgID, err := resolveOrganization(s.db, target.ID, 0)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateAccessTokenWithTTL(&utils.Claims{
+		UserID: target.ID,
+		Role:   target.Role,
+		OrgID:  orgID,
+		Act:    &utils.ActorClaim{Sub: strconv.FormatUint(uint64(actor.ID), 10), UserID: actor.ID},
+	}, ImpersonationTTL())
+}
+
+// ImpersonationTTL returns the configured lifetime of impersonation tokens
+func ImpersonationTTL() time.Duration {
+	if config.AppConfig.ImpersonationTTL > 0 {
+		return config.AppConfig.ImpersonationTTL
+	}
+	return defaultImpersonationTTL
+}
+
+// FindRefreshToken looks up a raw refresh token, e.g. for OAuth2 introspection
+func (s *TokenService) FindRefreshToken(rawToken string) (*models.RefreshToken, error) {
+	var stored models.RefreshToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&stored).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// issue signs an access token and persists a new refresh token in the given family
+func (s *TokenService) issue(db *gorm.DB, user *models.User, familyID string, grant TokenGrant) (*TokenPair, error) {
+	orgID, err := resolveOrganization(db, user.ID, grant.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	grant.OrgID = orgID
+
+	accessGrant := grant
+	if grant.AccessScopes != nil {
+		accessGrant.Scopes = grant.AccessScopes
+	}
+	accessToken, err := signAccessToken(user, accessGrant)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefresh, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawRefresh),
+		FamilyID:  familyID,
+		MFA:       grant.MFA,
+		Scope:     utils.FormatScope(grant.Scopes),
+		ClientID:  grant.ClientID,
+		OrgID:     grant.OrgID,
+		SessionID: grant.SessionID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+	// A session lasts as long as its newest refresh token
+	if grant.SessionID != "" {
+		if err := db.Model(&models.Session{}).Where("id = ?", grant.SessionID).
+			Updates(map[string]interface{}{"expires_at": refreshToken.ExpiresAt, "last_seen_at": time.Now()}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    int64(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// refreshTokenTTL returns the configured lifetime of refresh tokens
+func refreshTokenTTL() time.Duration {
+	if config.AppConfig.RefreshTokenTTL > 0 {
+		return config.AppConfig.RefreshTokenTTL
+	}
+	return defaultRefreshTokenTTL
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/testdb"
+	"gocheck/utils"
+	"testing"
+)
+
+// withTestSigningKey configures an HS256 key so tests can issue and validate tokens
+func withTestSigningKey(t *testing.T) {
+	t.Helper()
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+
+	config.AppConfig.JWTAlgorithm = "HS256"
+	config.AppConfig.JWTSecret = "test-secret-that-is-long-enough-for-hs256"
+	config.AppConfig.JWTKeyID = "test"
+	config.AppConfig.JWTRetiredKeys = nil
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	tokens := NewTokenService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	first, err := tokens.IssueTokenPair(user, TokenGrant{MFA: true, Scopes: []string{"books:read"}})
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	second, err := tokens.Refresh(first.RefreshToken, "", nil)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("Refresh returned the presented refresh token")
+	}
+
+	// The grant carries over to the rotated tokens
+	claims, err := tokens.ValidateAccessToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if !claims.MFA || claims.Scope != "books:read" || claims.UserID != user.ID {
+		t.Errorf("rotated access token claims = %+v, want the original grant", claims)
+	}
+
+	if _, err := tokens.Refresh(second.RefreshToken, "", nil); err != nil {
+		t.Errorf("Refresh of the newest token: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	tokens := NewTokenService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	first, err := tokens.IssueTokenPair(user, TokenGrant{})
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	second, err := tokens.Refresh(first.RefreshToken, "", nil)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// Presenting the rotated-out token again looks like theft
+	if _, err := tokens.Refresh(first.RefreshToken, "", nil); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused Refresh error = %v, want ErrRefreshTokenReused", err)
+	}
+	// ...so the legitimate holder's newest token stops working too
+	if _, err := tokens.Refresh(second.RefreshToken, "", nil); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh after reuse error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	var outstanding int64
+	if err := db.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&outstanding).Error; err != nil {
+		t.Fatalf("count refresh tokens: %v", err)
+	}
+	if outstanding != 0 {
+		t.Errorf("%d refresh tokens of the family are still valid", outstanding)
+	}
+}
+
+func TestRefreshReuseLeavesOtherFamilies(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	tokens := NewTokenService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	stolen, err := tokens.IssueTokenPair(user, TokenGrant{})
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	otherDevice, err := tokens.IssueTokenPair(user, TokenGrant{})
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	if _, err := tokens.Refresh(stolen.RefreshToken, "", nil); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := tokens.Refresh(stolen.RefreshToken, "", nil); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused Refresh error = %v, want ErrRefreshTokenReused", err)
+	}
+
+	if _, err := tokens.Refresh(otherDevice.RefreshToken, "", nil); err != nil {
+		t.Errorf("another login's family was revoked: %v", err)
+	}
+}
+
+func TestRefreshRejectsOtherClient(t *testing.T) {
+	withTestSigningKey(t)
+	db := testdb.Open(t)
+	tokens := NewTokenService(db)
+	user := testdb.CreateUser(t, db, "user")
+
+	pair, err := tokens.IssueTokenPair(user, TokenGrant{})
+	if err != nil {
+		t.Fatalf("IssueTokenPair: %v", err)
+	}
+	if _, err := tokens.Refresh(pair.RefreshToken, "some-client", nil); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh by another client error = %v, want ErrInvalidRefreshToken", err)
+	}
+	// The failed attempt does not use up the token
+	if _, err := tokens.Refresh(pair.RefreshToken, "", nil); err != nil {
+		t.Errorf("Refresh by the owning client: %v", err)
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	db := testdb.Open(t)
+	if _, err := NewTokenService(db).Refresh("not-a-token", "", nil); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh of an unknown token error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
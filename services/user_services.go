@@ -2,15 +2,44 @@ package services
 
 import (
 	"errors"
+	"gocheck/config"
 	"gocheck/models"
 	"gocheck/utils"
+	"log"
+	"sync"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// UserService provides business logic for user operations
+// ErrInvalidCredentials is returned by AuthenticateUser for an unknown email or wrong password
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// ErrEmailNotVerified is returned by AuthenticateUser when verification is required and still pending
+var ErrEmailNotVerified = errors.New("email address not verified")
+
+// ErrIncorrectPassword is returned when the current password supplied for a password change is wrong
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+// ErrUnknownRole is returned when a user is assigned a role that does not exist
+var ErrUnknownRole = errors.New("unknown role")
+
+// ErrAccountSuspended is returned when a suspended account tries to authenticate
+var ErrAccountSuspended = errors.New("account is suspended")
+
+// ErrAccountDeactivated is returned when a deactivated account tries to authenticate
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// ErrInvalidStatus is returned for an unknown status or a suspension end in the past
+var ErrInvalidStatus = errors.New("invalid account status")
+
+// UserService provides business logic for user operations. Every mutation is
+// written to the audit log in the same transaction, attributed to the actor set
+// with WithActor. WithTenant confines lookups to members of one organization.
 type UserService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	actor  *AuditActor
+	tenant *uint
 }
 
 // NewUserService creates a new UserService
@@ -18,8 +47,34 @@ func NewUserService(db *gorm.DB) *UserService {
 	return &UserService{db: db}
 }
 
+// WithActor returns a copy of the service whose mutations are audited as actor
+func (s *UserService) WithActor(actor AuditActor) *UserService {
+	scoped := *s
+	scoped.actor = &actor
+	return &scoped
+}
+
+// WithTenant returns a copy of the service that only sees members of orgID
+func (s *UserService) WithTenant(orgID uint) *UserService {
+	scoped := *s
+	scoped.tenant = &orgID
+	return &scoped
+}
+
+// scope applies the tenant restriction, if any, to a query on users
+func (s *UserService) scope(db *gorm.DB) *gorm.DB {
+	if s.tenant == nil {
+		return db
+	}
+	return userTenantScope(*s.tenant)(db)
+}
+
 // CreateUser creates a new user in the database
 func (s *UserService) CreateUser(user *models.User) error {
+	if err := utils.ValidatePassword(user.Password, user.Username, user.Email); err != nil {
+		return err
+	}
+
 	// Hash the password before saving
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -27,16 +82,28 @@ func (s *UserService) CreateUser(user *models.User) error {
 	}
 	user.Password = hashedPassword
 
-	if err := s.db.Create(user).Error; err != nil {
-		return err
-	}
-	return nil
+	// New addresses always start unverified and without 2FA, whatever the request body said
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
+	user.TOTPEnabled = false
+	user.Roles = nil // Extra roles are only granted through the admin role endpoints
+	user.Status = models.UserStatusActive
+	user.StatusReason = ""
+	user.SuspendedUntil = nil
+	user.StatusChangedAt = nil
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, s.actor, "user.create", "user", user.ID, nil, auditSnapshot(user))
+	})
 }
 
 // GetUserByID retrieves a user by their ID
 func (s *UserService) GetUserByID(id uint) (*models.User, error) {
 	var user models.User
-	if err := s.db.First(&user, id).Error; err != nil {
+	if err := s.db.Scopes(s.scope).First(&user, id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -48,12 +115,12 @@ func (s *UserService) GetUsersPaginated(limit, offset int) ([]models.User, int64
 	var total int64
 
 	// Count total users for frontend pagination info
-	if err := s.db.Model(&models.User{}).Count(&total).Error; err != nil {
+	if err := s.db.Model(&models.User{}).Scopes(s.scope).Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	// Fetch the limited users based on limit & offset
-	if err := s.db.Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+	if err := s.db.Scopes(s.scope).Limit(limit).Offset(offset).Find(&users).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -67,28 +134,150 @@ func (s *UserService) UpdateUser(user *models.User) (*models.User, error) {
 	if err != nil {
 		return nil, err // User not found or other DB error
 	}
+	before := auditSnapshot(existingUser)
 
 	// Update only the fields that are provided (e.g., username, email).
 	// Password update should be handled separately if it's a security concern.
 	existingUser.Username = user.Username
-	existingUser.Email = user.Email
+	if existingUser.Email != user.Email {
+		// A changed address has to be verified again
+		existingUser.Email = user.Email
+		existingUser.EmailVerified = false
+		existingUser.EmailVerifiedAt = nil
+	}
 	existingUser.Name.FirstName = user.Name.FirstName
 	existingUser.Name.LastName = user.Name.LastName
 
-	if err := s.db.Save(existingUser).Error; err != nil {
+	// The role is only changed when one is given; callers authorize role changes
+	if user.Role != "" && user.Role != existingUser.Role {
+		var count int64
+		if err := s.db.Model(&models.Role{}).Where("name = ?", user.Role).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrUnknownRole
+		}
+		existingUser.Role = user.Role
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(existingUser).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, s.actor, "user.update", "user", existingUser.ID, before, auditSnapshot(existingUser))
+	})
+	if err != nil {
 		return nil, err
 	}
 	return existingUser, nil
 }
 
+// ChangePassword replaces a user's password after verifying their current one
+func (s *UserService) ChangePassword(id uint, currentPassword, newPassword string) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPasswordHash(currentPassword, user.Password) {
+		return ErrIncorrectPassword
+	}
+
+	if err := utils.ValidatePassword(newPassword, user.Username, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		// Only the fact that it changed is recorded; auditDiff redacts the hashes
+		before := map[string]interface{}{"password": user.Password}
+		after := map[string]interface{}{"password": hashedPassword}
+		return recordChange(tx, s.actor, "user.change_password", "user", user.ID, before, after)
+	})
+}
+
+// DeactivateUser lets a user deactivate their own account after confirming their password
+func (s *UserService) DeactivateUser(id uint, password, reason string) (*models.User, error) {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+	return s.setStatus("user.deactivate", id, models.UserStatusDeactivated, reason, nil)
+}
+
 // DeleteUser deletes a user by their ID
 func (s *UserService) DeleteUser(id uint) error {
-	if err := s.db.Delete(&models.User{}, id).Error; err != nil {
+	user, err := s.GetUserByID(id)
+	if err != nil {
 		return err
 	}
-	return nil
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var bookCount int64
+		if err := tx.Model(&models.Book{}).Where("user_id = ?", id).Count(&bookCount).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.User{}, id).Error; err != nil {
+			return err
+		}
+		before := auditSnapshot(user)
+		before["books_deleted"] = bookCount // Removed by the cascade
+		return recordChange(tx, s.actor, "user.delete", "user", id, before, nil)
+	})
 }
 
+// DeleteAccount deletes the user's own account after verifying their password.
+// It is refused with ErrLastOwner while the user is the only owner of an
+// organization that has other members, who would be left without an owner.
+func (s *UserService) DeleteAccount(id uint, password string) error {
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return ErrIncorrectPassword
+	}
+
+	var owned []models.OrganizationMembership
+	if err := s.db.Where("user_id = ? AND role = ?", id, models.OrgRoleOwner).Find(&owned).Error; err != nil {
+		return err
+	}
+	for _, membership := range owned {
+		var others int64
+		if err := s.db.Model(&models.OrganizationMembership{}).
+			Where("organization_id = ? AND user_id <> ?", membership.OrganizationID, id).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if others == 0 {
+			continue
+		}
+		if err := ensureAnotherOwner(s.db, membership.OrganizationID, id); err != nil {
+			return err
+		}
+	}
+	return s.DeleteUser(id)
+}
+
+// dummyPasswordHash returns a hash, made once with the current hashing settings,
+// that AuthenticateUser checks against when no account matches the email
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := utils.HashPassword("gocheck-dummy-password")
+	if err != nil {
+		log.Printf("Failed to create dummy password hash: %v", err)
+	}
+	return hash
+})
+
 // AuthenticateUser authenticates a user by email and password
 // It returns the authenticated user if successful, or an error.
 func (s *UserService) AuthenticateUser(email, password string) (*models.User, error) {
@@ -98,21 +287,105 @@ func (s *UserService) AuthenticateUser(email, password string) (*models.User, er
 	// Use .Limit(1) to ensure only one user is returned, though email is unique
 	if err := s.db.Where("email = ?", email).Limit(1).Find(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid credentials") // Return a generic error for security
+			return nil, ErrInvalidCredentials // Return a generic error for security
 		}
 		return nil, err // Other database error
 	}
 
 	// 2. Check if the user was found (should be caught by gorm.ErrRecordNotFound, but good to be explicit)
 	if user.ID == 0 {
-		return nil, errors.New("invalid credentials")
+		// Spend as long as a real password check so response times do not reveal
+		// which email addresses are registered
+		utils.CheckPasswordHash(password, dummyPasswordHash())
+		return nil, ErrInvalidCredentials
 	}
 
 	// 3. Compare the provided password with the hashed password from the database
 	if !utils.CheckPasswordHash(password, user.Password) {
-		return nil, errors.New("invalid credentials") // Return a generic error for security
+		return nil, ErrInvalidCredentials // Return a generic error for security
+	}
+
+	// 4. Transparently upgrade hashes made with an outdated algorithm or cost.
+	// The login still succeeds if the upgrade fails; it is retried next time.
+	if utils.NeedsRehash(user.Password) {
+		if newHash, err := utils.HashPassword(password); err == nil {
+			if err := s.db.Model(&user).Update("password", newHash).Error; err != nil {
+				log.Printf("Failed to upgrade password hash for user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	// 5. Only reveal the verification state once the password has been proven
+	if config.AppConfig.RequireEmailVerification && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// 6. Suspended and deactivated accounts cannot log in
+	if err := CheckAccountStatus(&user); err != nil {
+		return nil, err
 	}
 
 	// Authentication successful
 	return &user, nil
 }
+
+// CheckAccountStatus returns ErrAccountSuspended or ErrAccountDeactivated unless
+// the user may currently authenticate
+func CheckAccountStatus(user *models.User) error {
+	switch user.EffectiveStatus(time.Now()) {
+	case models.UserStatusActive:
+		return nil
+	case models.UserStatusSuspended:
+		return ErrAccountSuspended
+	default:
+		return ErrAccountDeactivated
+	}
+}
+
+// SetStatus changes a user's account status. suspendedUntil is only kept for
+// suspensions and, when given, must lie in the future; nil suspends indefinitely.
+// Callers are expected to revoke the user's tokens when the account is disabled.
+func (s *UserService) SetStatus(id uint, status, reason string, suspendedUntil *time.Time) (*models.User, error) {
+	return s.setStatus("user.change_status", id, status, reason, suspendedUntil)
+}
+
+// setStatus changes the status and audits it under the given action
+func (s *UserService) setStatus(action string, id uint, status, reason string, suspendedUntil *time.Time) (*models.User, error) {
+	now := time.Now()
+	switch status {
+	case models.UserStatusActive, models.UserStatusDeactivated:
+		suspendedUntil = nil
+	case models.UserStatusSuspended:
+		if suspendedUntil != nil && !suspendedUntil.After(now) {
+			return nil, ErrInvalidStatus
+		}
+	default:
+		return nil, ErrInvalidStatus
+	}
+	if status == models.UserStatusActive {
+		reason = ""
+	}
+
+	user, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	before := auditSnapshot(user)
+
+	user.Status = status
+	user.StatusReason = reason
+	user.SuspendedUntil = suspendedUntil
+	user.StatusChangedAt = &now
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Select so that clearing the reason and end time is written too
+		err := tx.Model(user).Select("status", "status_reason", "suspended_until", "status_changed_at").Updates(user).Error
+		if err != nil {
+			return err
+		}
+		return recordChange(tx, s.actor, action, "user", user.ID, before, auditSnapshot(user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
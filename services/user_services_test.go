@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"gocheck/config"
+	"gocheck/models"
+	"gocheck/testdb"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticateUserUpgradesOutdatedHash(t *testing.T) {
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.RequireEmailVerification = false
+	config.AppConfig.PasswordHash = config.PasswordHashConfig{Algorithm: "argon2id", Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+
+	db := testdb.Open(t)
+	users := NewUserService(db)
+	user := testdb.CreateUser(t, db, "user")
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(user).Update("password", string(legacy)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed login leaves the stored hash alone
+	if _, err := users.AuthenticateUser(user.Email, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: error = %v, want ErrInvalidCredentials", err)
+	}
+	var stored models.User
+	db.First(&stored, user.ID)
+	if stored.Password != string(legacy) {
+		t.Error("a failed login replaced the hash")
+	}
+
+	if _, err := users.AuthenticateUser(user.Email, "correct horse"); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+	db.First(&stored, user.ID)
+	if !strings.HasPrefix(stored.Password, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash after login = %q, want an Argon2id hash with the configured parameters", stored.Password)
+	}
+
+	// The upgraded hash still logs the user in, and is not rehashed again
+	upgraded := stored.Password
+	if _, err := users.AuthenticateUser(user.Email, "correct horse"); err != nil {
+		t.Fatalf("login with the upgraded hash: %v", err)
+	}
+	db.First(&stored, user.ID)
+	if stored.Password != upgraded {
+		t.Error("a current hash was replaced")
+	}
+}
+
+func TestAuthenticateUserUnknownEmail(t *testing.T) {
+	db := testdb.Open(t)
+	if _, err := NewUserService(db).AuthenticateUser("nobody@example.com", "secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown email: error = %v, want ErrInvalidCredentials", err)
+	}
+}
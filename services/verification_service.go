@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"gocheck/mailer"
+	"gocheck/models"
+	"gocheck/utils"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidVerificationToken is returned for invalid, expired or outdated verification links
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+
+// defaultEmailVerificationTTL is used when the configuration does not provide a lifetime
+const defaultEmailVerificationTTL = 48 * time.Hour
+
+// VerificationService handles email address verification
+type VerificationService struct {
+	db     *gorm.DB
+	mailer mailer.Mailer
+}
+
+// NewVerificationService creates a new VerificationService
+func NewVerificationService(db *gorm.DB, m mailer.Mailer) *VerificationService {
+	return &VerificationService{db: db, mailer: m}
+}
+
+// SendVerification emails a signed verification link for the user's current address
+func (s *VerificationService) SendVerification(user *models.User) error {
+	token, err := utils.GenerateActionToken(utils.PurposeEmailVerification, user.ID, user.Email, emailVerificationTTL())
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/users/verify?token=%s", config.AppConfig.BaseURL, url.QueryEscape(token))
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			user.Username, emailVerificationTTL(), link),
+	})
+}
+
+// ResendVerification sends a new link to an unverified address. Unknown and
+// already verified addresses are ignored so callers cannot probe for accounts.
+func (s *VerificationService) ResendVerification(email string) error {
+	var user models.User
+	if err := s.db.Where("email = ?", email).Limit(1).Find(&user).Error; err != nil {
+		return err
+	}
+	if user.ID == 0 || user.EmailVerified {
+		return nil
+	}
+	return s.SendVerification(&user)
+}
+
+// Verify marks the address in a verification token as verified. Links issued for
+// an address the user has since changed are rejected.
+func (s *VerificationService) Verify(token string) (*models.User, error) {
+	claims, err := utils.ValidateActionToken(token, utils.PurposeEmailVerification)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	if err := s.db.First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return &user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	if err := s.db.Model(&user).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// emailVerificationTTL returns the configured lifetime of verification links
+func emailVerificationTTL() time.Duration {
+	if config.AppConfig.EmailVerificationTTL > 0 {
+		return config.AppConfig.EmailVerificationTTL
+	}
+	return defaultEmailVerificationTTL
+}
@@ -0,0 +1,61 @@
+// Package testdb connects tests to a Postgres database. It is only imported
+// from _test.go files; see the Makefile for how to run the tests that use it.
+package testdb
+
+import (
+	"fmt"
+	"gocheck/database"
+	"gocheck/models"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	migrateOnce sync.Once
+	userSeq     atomic.Int64
+)
+
+// Open returns a transaction on the database named by TEST_DATABASE_URL that is
+// rolled back when the test ends. Tests using it are skipped without that
+// variable. Every test binary migrates the same schema, so packages must run one
+// at a time (go test -p 1).
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	migrateOnce.Do(func() { database.Migrate(db) })
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// CreateUser inserts an active user with the given primary role
+func CreateUser(t *testing.T, db *gorm.DB, role string) *models.User {
+	t.Helper()
+	name := fmt.Sprintf("%s%d%d", role, time.Now().UnixNano(), userSeq.Add(1))
+	user := models.User{
+		Name:     &models.Name{FirstName: "Test", LastName: role},
+		Username: name,
+		Email:    name + "@example.com",
+		Password: "unused",
+		Role:     role,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return &user
+}
@@ -1,15 +1,158 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"strings"
 
-// HashPassword hashes a plain-text password using bcrypt
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashes are self-describing: bcrypt hashes start with "$2a$"/"$2b$" and
+// Argon2id hashes use the PHC string format
+// "$argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>".
+const argon2idPrefix = "$argon2id$"
+
+// Defaults used when the configuration does not provide hashing parameters
+const (
+	defaultHashAlgorithm     = "argon2id"
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// argon2Params are the tunable Argon2id parameters encoded in each hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// HashPassword hashes a plain-text password with the configured algorithm and cost
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	if hashAlgorithm() == "bcrypt" {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
+		return string(bytes), err
+	}
+	return hashArgon2id(password, currentArgon2Params())
 }
 
-// CheckPasswordHash compares a plain-text password with its bcrypt hash
+// CheckPasswordHash compares a plain-text password with a bcrypt or Argon2id hash.
+// Passwords longer than MaxPasswordLength never match, so they are not hashed.
 func CheckPasswordHash(password, hash string) bool {
+	if len(password) > MaxPasswordLength {
+		return false
+	}
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// NeedsRehash reports whether a stored hash uses a different algorithm or weaker
+// parameters than currently configured, so it should be replaced after a successful login
+func NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		if hashAlgorithm() != "argon2id" {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil || params != currentArgon2Params()
+	}
+
+	if hashAlgorithm() != "bcrypt" {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != bcryptCost()
+}
+
+// hashArgon2id derives an Argon2id key with a random salt and encodes it in PHC format
+func hashArgon2id(password string, params argon2Params) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, params.memory, params.iterations, params.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// decodeArgon2id parses a PHC-format Argon2id hash
+func decodeArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, errors.New("malformed argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+// hashAlgorithm returns the configured algorithm for new hashes
+func hashAlgorithm() string {
+	if config.AppConfig.PasswordHash.Algorithm != "" {
+		return config.AppConfig.PasswordHash.Algorithm
+	}
+	return defaultHashAlgorithm
+}
+
+// bcryptCost returns the configured bcrypt cost
+func bcryptCost() int {
+	if config.AppConfig.PasswordHash.BcryptCost > 0 {
+		return config.AppConfig.PasswordHash.BcryptCost
+	}
+	return bcrypt.DefaultCost
+}
+
+// currentArgon2Params returns the configured Argon2id parameters
+func currentArgon2Params() argon2Params {
+	cfg := config.AppConfig.PasswordHash
+	params := argon2Params{memory: cfg.Argon2Memory, iterations: cfg.Argon2Iterations, parallelism: cfg.Argon2Parallelism}
+	if params.memory == 0 {
+		params.memory = defaultArgon2Memory
+	}
+	if params.iterations == 0 {
+		params.iterations = defaultArgon2Iterations
+	}
+	if params.parallelism == 0 {
+		params.parallelism = defaultArgon2Parallelism
+	}
+	return params
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"encoding/base64"
+	"gocheck/config"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// withHashConfig installs password hashing settings for the duration of a test.
+// The Argon2id parameters are far below production strength to keep tests fast.
+func withHashConfig(t *testing.T, cfg config.PasswordHashConfig) {
+	t.Helper()
+	saved := config.AppConfig.PasswordHash
+	config.AppConfig.PasswordHash = cfg
+	t.Cleanup(func() { config.AppConfig.PasswordHash = saved })
+}
+
+func testArgon2Config() config.PasswordHashConfig {
+	return config.PasswordHashConfig{Algorithm: "argon2id", Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+}
+
+func TestArgon2idHashRoundTrip(t *testing.T) {
+	withHashConfig(t, testArgon2Config())
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash %q is not a PHC string with the configured parameters", hash)
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		t.Fatalf("decodeArgon2id: %v", err)
+	}
+	if params != (argon2Params{memory: 1024, iterations: 1, parallelism: 1}) {
+		t.Errorf("decoded parameters = %+v", params)
+	}
+	if len(salt) != argon2SaltLength || len(key) != argon2KeyLength {
+		t.Errorf("salt is %d bytes and key %d bytes, want %d and %d", len(salt), len(key), argon2SaltLength, argon2KeyLength)
+	}
+
+	if !CheckPasswordHash("correct horse", hash) {
+		t.Error("the hashed password does not verify")
+	}
+	if CheckPasswordHash("correct horsE", hash) {
+		t.Error("a different password verifies")
+	}
+
+	other, _ := HashPassword("correct horse")
+	if other == hash {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestCheckPasswordHashUsesEncodedParameters(t *testing.T) {
+	// A hash made by hand with other parameters verifies against what it encodes,
+	// not against the current configuration
+	withHashConfig(t, testArgon2Config())
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("secret"), salt, 2, 2048, 2, 24)
+	hash := "$argon2id$v=19$m=2048,t=2,p=2$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+
+	if !CheckPasswordHash("secret", hash) {
+		t.Error("hash with non-default parameters does not verify")
+	}
+}
+
+func TestCheckPasswordHashRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$not base64$a2V5",
+	} {
+		if CheckPasswordHash("secret", hash) {
+			t.Errorf("malformed hash %q verifies", hash)
+		}
+	}
+}
+
+func TestCheckPasswordHashAcceptsBcrypt(t *testing.T) {
+	withHashConfig(t, testArgon2Config())
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPasswordHash("secret", string(legacy)) {
+		t.Error("bcrypt hash does not verify")
+	}
+	if CheckPasswordHash("Secret", string(legacy)) {
+		t.Error("bcrypt hash verifies another password")
+	}
+}
+
+func TestCheckPasswordHashRejectsOverlongPasswords(t *testing.T) {
+	withHashConfig(t, testArgon2Config())
+	// A stored hash of an overlong password must still not match, so no input
+	// beyond the limit is ever hashed
+	long := strings.Repeat("a", MaxPasswordLength+1)
+	hash, err := hashArgon2id(long, currentArgon2Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CheckPasswordHash(long, hash) {
+		t.Error("password longer than MaxPasswordLength verifies")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	withHashConfig(t, testArgon2Config())
+	current, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*config.PasswordHashConfig)
+		hash   string
+		want   bool
+	}{
+		{"current argon2id hash", nil, current, false},
+		{"bcrypt hash while argon2id is configured", nil, string(legacy), true},
+		{"more memory configured", func(c *config.PasswordHashConfig) { c.Argon2Memory = 2048 }, current, true},
+		{"more iterations configured", func(c *config.PasswordHashConfig) { c.Argon2Iterations = 2 }, current, true},
+		{"more parallelism configured", func(c *config.PasswordHashConfig) { c.Argon2Parallelism = 2 }, current, true},
+		{"switched back to bcrypt", func(c *config.PasswordHashConfig) {
+			c.Algorithm, c.BcryptCost = "bcrypt", bcrypt.MinCost
+		}, current, true},
+		{"bcrypt hash at the configured cost", func(c *config.PasswordHashConfig) {
+			c.Algorithm, c.BcryptCost = "bcrypt", bcrypt.MinCost
+		}, string(legacy), false},
+		{"bcrypt cost raised", func(c *config.PasswordHashConfig) {
+			c.Algorithm, c.BcryptCost = "bcrypt", bcrypt.MinCost+1
+		}, string(legacy), true},
+		{"malformed hash", nil, "$argon2id$garbage", true},
+	}
+	for _, tt := range tests {
+		cfg := testArgon2Config()
+		if tt.modify != nil {
+			tt.modify(&cfg)
+		}
+		config.AppConfig.PasswordHash = cfg
+		if got := NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRehashUsesNewParameters(t *testing.T) {
+	withHashConfig(t, testArgon2Config())
+	old, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testArgon2Config()
+	cfg.Argon2Iterations = 2
+	config.AppConfig.PasswordHash = cfg
+	if !NeedsRehash(old) {
+		t.Fatal("hash made before the parameter change does not need a rehash")
+	}
+
+	upgraded, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(upgraded) || !CheckPasswordHash("secret", upgraded) {
+		t.Errorf("upgraded hash %q is not current or does not verify", upgraded)
+	}
+	// The old hash stays valid until the user next logs in
+	if !CheckPasswordHash("secret", old) {
+		t.Error("old hash stopped verifying after the parameter change")
+	}
+}
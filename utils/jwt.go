@@ -2,42 +2,186 @@ package utils
 
 import (
 	"errors"
+	"gocheck/config"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5" // Import the new JWT library
 )
 
+// Token subjects. Access tokens and single-purpose tokens are signed with the same
+// keys, so the subject is what stops one kind from being accepted as another.
+const (
+	SubjectAccess            = "user_authentication"
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAPending        = "mfa_pending"
+	PurposeOIDCLogin         = "oidc_login"
+)
+
 // Define a struct for custom JWT claims (payload)
 type Claims struct {
+	UserID    uint   `json:"user_id"`
+	Role      string `json:"role"`
+	MFA       bool   `json:"mfa,omitempty"`       // Set when the login completed a second factor
+	Scope     string `json:"scope,omitempty"`     // Space-separated scopes; empty means unrestricted
+	ClientID  string `json:"client_id,omitempty"` // OAuth2 client the token was issued to, if any
+	OrgID     uint   `json:"org,omitempty"`       // Organization the token is confined to; 0 for none
+	SessionID string `json:"sid,omitempty"`       // Login session the token belongs to, see models.Session
+	// Act names the admin acting as UserID in an impersonation token (RFC 8693 "act")
+	Act *ActorClaim `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ActorClaim identifies the real user behind an impersonation token
+type ActorClaim struct {
+	Sub    string `json:"sub"`
+	UserID uint   `json:"user_id"`
+}
+
+// Scopes returns the scopes the token is limited to, or nil if it is unrestricted
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// ActionClaims is the payload of single-purpose tokens such as email verification links
+type ActionClaims struct {
 	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	Email  string `json:"email,omitempty"`
+	Scope  string `json:"scope,omitempty"` // Scope requested for the tokens this one leads to
 	jwt.RegisteredClaims
 }
 
-// TODO: Store this in an environment variable or a secure configuration
-// NEVER hardcode this in a production application!
-var jwtSecret = []byte("your_super_secret_jwt_key_that_is_at_least_32_bytes_long")
+// Scopes returns the scopes carried by the token, or nil if none were requested
+func (c *ActionClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
 
-// GenerateToken generates a new JWT for the given user ID
-func GenerateToken(userID uint, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// OIDCStateClaims bind an OpenID Connect login to the browser that started it.
+// The token is kept in an HttpOnly cookie between the redirect and the callback.
+type OIDCStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	jwt.RegisteredClaims
+}
+
+func init() {
+	// Millisecond timestamps let a "log out everywhere" cutoff tell apart tokens
+	// issued just before it from ones issued right after, within the same second
+	jwt.TimePrecision = time.Millisecond
+}
+
+// defaultAccessTokenTTL is used when the configuration does not provide a lifetime
+const defaultAccessTokenTTL = 15 * time.Minute
+
+// AccessTokenTTL returns the configured lifetime of access tokens
+func AccessTokenTTL() time.Duration {
+	if config.AppConfig.AccessTokenTTL > 0 {
+		return config.AppConfig.AccessTokenTTL
+	}
+	return defaultAccessTokenTTL
+}
 
-	claims := &Claims{
+// GenerateToken generates a new short-lived access token for the given user ID
+func GenerateToken(userID uint, role string) (string, error) {
+	return GenerateAccessToken(&Claims{
 		UserID: userID,
 		Role:   role, // Include the role in the token
+	})
+}
+
+// GenerateAccessToken signs an access token carrying the given custom claims.
+// The registered claims (jti, expiry, issue time, subject) are always set here.
+func GenerateAccessToken(claims *Claims) (string, error) {
+	return GenerateAccessTokenWithTTL(claims, AccessTokenTTL())
+}
+
+// GenerateAccessTokenWithTTL is GenerateAccessToken with a custom lifetime,
+// e.g. for short-lived impersonation tokens
+func GenerateAccessTokenWithTTL(claims *Claims, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
+
+	// Unique token ID (jti) so individual tokens can be revoked server-side
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
 
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		ExpiresAt: jwt.NewNumericDate(expirationTime),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		Subject:   SubjectAccess,
+	}
+
+	return signClaims(claims)
+}
+
+// ValidateToken validates a JWT string and returns the claims if valid
+func ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := parseClaims(tokenString, claims, SubjectAccess); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// GenerateActionToken signs a single-purpose token (e.g. an email verification link)
+// that can only be validated for the same purpose
+func GenerateActionToken(purpose string, userID uint, email string, ttl time.Duration) (string, error) {
+	return generateActionToken(purpose, userID, email, "", ttl)
+}
+
+// GenerateScopedActionToken is GenerateActionToken for steps of a login, such as
+// the MFA pending token, that must carry the scope requested for the final tokens
+func GenerateScopedActionToken(purpose string, userID uint, scope string, ttl time.Duration) (string, error) {
+	return generateActionToken(purpose, userID, "", scope, ttl)
+}
+
+func generateActionToken(purpose string, userID uint, email, scope string, ttl time.Duration) (string, error) {
+	// Unique token ID (jti) so single-use tokens can be consumed server-side
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &ActionClaims{
+		UserID: userID,
+		Email:  email,
+		Scope:  scope,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "user_authentication",
+			Subject:   purpose,
 		},
 	}
+	return signClaims(claims)
+}
+
+// ValidateActionToken validates a single-purpose token and returns its claims
+func ValidateActionToken(tokenString, purpose string) (*ActionClaims, error) {
+	claims := &ActionClaims{}
+	if err := parseClaims(tokenString, claims, purpose); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// signClaims signs claims with the active key
+func signClaims(claims jwt.Claims) (string, error) {
+	key, err := signingKey()
+	if err != nil {
+		return "", err
+	}
 
-	// Create the token with the algorithm and claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Create the token with the configured algorithm, stamping the key ID so
+	// verifiers can pick the right key after a rotation
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(jwtSecret)
+	// Sign the token with the active key
+	tokenString, err := token.SignedString(key.SignKey)
 	if err != nil {
 		return "", err
 	}
@@ -45,25 +189,45 @@ func GenerateToken(userID uint, role string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT string and returns the claims if valid
-func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-
+// parseClaims verifies a token's signature, expiry and subject and fills claims
+func parseClaims(tokenString string, claims jwt.Claims, subject string) error {
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Verify the signing method is what we expect
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrSignatureInvalid // Return a specific error if method is wrong
-		}
-		return jwtSecret, nil
-	})
+		// The key lookup also verifies the signing method matches the key
+		kid, _ := token.Header["kid"].(string)
+		return verificationKey(kid, token.Method)
+	}, jwt.WithSubject(subject))
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !token.Valid {
-		return nil, errors.New("invalid token") // Use errors.New("invalid token") from standard library
+		return errors.New("invalid token") // Use errors.New("invalid token") from standard library
 	}
 
+	return nil
+}
+
+// GenerateOIDCStateToken signs the state, nonce and PKCE verifier of a pending OIDC login
+func GenerateOIDCStateToken(state, nonce, codeVerifier string, ttl time.Duration) (string, error) {
+	claims := &OIDCStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   PurposeOIDCLogin,
+		},
+	}
+	return signClaims(claims)
+}
+
+// ValidateOIDCStateToken validates a pending OIDC login token and returns its claims
+func ValidateOIDCStateToken(tokenString string) (*OIDCStateClaims, error) {
+	claims := &OIDCStateClaims{}
+	if err := parseClaims(tokenString, claims, PurposeOIDCLogin); err != nil {
+		return nil, err
+	}
 	return claims, nil
 }
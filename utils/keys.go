@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gocheck/config"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey is returned when a token references a key that is unknown or past its grace period
+var ErrUnknownKey = errors.New("unknown or expired signing key")
+
+// SigningKey is a key loaded from configuration. The active key can sign;
+// retired keys are verify-only and accepted until ExpiresAt.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // []byte or crypto.Signer; nil for retired keys
+	VerifyKey interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+	ExpiresAt time.Time   // Zero for the active key
+}
+
+// keyRing holds the active signing key and the retired keys still in their grace period
+type keyRing struct {
+	active  *SigningKey
+	retired []*SigningKey
+}
+
+var keys *keyRing
+
+// LoadSigningKeys reads the active and retired keys described by config.AppConfig.
+// It must be called once after config.LoadConfig and before tokens are issued.
+func LoadSigningKeys() error {
+	cfg := config.AppConfig
+
+	active, err := loadKey(cfg.JWTKeyID, cfg.JWTAlgorithm, cfg.JWTSecret, cfg.JWTPrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load active JWT key: %w", err)
+	}
+	if active.SignKey == nil {
+		return fmt.Errorf("active JWT key '%s' must be a private key", active.ID)
+	}
+
+	ring := &keyRing{active: active}
+	for _, k := range cfg.JWTRetiredKeys {
+		retired, err := loadKey(k.ID, k.Algorithm, k.Secret, k.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load retired JWT key '%s': %w", k.ID, err)
+		}
+		retired.SignKey = nil // Retired keys never sign new tokens
+		retired.ExpiresAt = k.ExpiresAt
+		ring.retired = append(ring.retired, retired)
+	}
+
+	keys = ring
+	return nil
+}
+
+// loadKey builds a SigningKey from an HMAC secret or a PEM file. PEM files may
+// contain either a private key or, for verify-only keys, a public key.
+func loadKey(kid, algorithm, secret, keyFile string) (*SigningKey, error) {
+	switch algorithm {
+	case "HS256":
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)}, nil
+	case "RS256", "EdDSA":
+	default:
+		return nil, fmt.Errorf("unsupported algorithm '%s'", algorithm)
+	}
+
+	pemBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm == "RS256" {
+		if priv, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes); err == nil {
+			return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, SignKey: priv, VerifyKey: &priv.PublicKey}, nil
+		}
+		pub, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s does not contain an RSA key: %w", keyFile, err)
+		}
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, VerifyKey: pub}, nil
+	}
+
+	if priv, err := jwt.ParseEdPrivateKeyFromPEM(pemBytes); err == nil {
+		signer := priv.(crypto.Signer)
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, SignKey: signer, VerifyKey: signer.Public()}, nil
+	}
+	pub, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not contain an Ed25519 key: %w", keyFile, err)
+	}
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, VerifyKey: pub}, nil
+}
+
+// signingKey returns the key used to sign new tokens
+func signingKey() (*SigningKey, error) {
+	if keys == nil {
+		return nil, errors.New("JWT signing keys are not loaded")
+	}
+	return keys.active, nil
+}
+
+// verificationKey returns the key for the given kid, provided it was used with the
+// token's algorithm. The active key is always accepted; retired keys are accepted
+// until their grace period ends. Tokens without a kid predate key rotation and are
+// checked against the active key.
+func verificationKey(kid string, method jwt.SigningMethod) (interface{}, error) {
+	active, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := active
+	if kid != "" && kid != active.ID {
+		key = nil
+		for _, k := range keys.retired {
+			if k.ID == kid && time.Now().Before(k.ExpiresAt) {
+				key = k
+				break
+			}
+		}
+		if key == nil {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	// Reject tokens whose alg header does not match the key, preventing algorithm confusion
+	if method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.VerifyKey, nil
+}
+
+// JWK is a single public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS lists the public halves of the active and not-yet-expired retired
+// asymmetric keys. HMAC keys are shared secrets and are never published.
+func PublicJWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	if keys == nil {
+		return set
+	}
+
+	candidates := append([]*SigningKey{keys.active}, keys.retired...)
+	for _, k := range candidates {
+		if !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt) {
+			continue
+		}
+		switch pub := k.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				Kid: k.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				Kid: k.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
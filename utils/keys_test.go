@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"gocheck/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// withKeyConfig installs the given active key and retired keys, loads them and
+// restores the previous configuration and key ring when the test ends
+func withKeyConfig(t *testing.T, kid, algorithm, secret, keyFile string, retired ...config.JWTKey) error {
+	t.Helper()
+	savedConfig, savedKeys := config.AppConfig, keys
+	t.Cleanup(func() { config.AppConfig, keys = savedConfig, savedKeys })
+
+	config.AppConfig.JWTKeyID = kid
+	config.AppConfig.JWTAlgorithm = algorithm
+	config.AppConfig.JWTSecret = secret
+	config.AppConfig.JWTPrivateKeyFile = keyFile
+	config.AppConfig.JWTRetiredKeys = retired
+	return LoadSigningKeys()
+}
+
+func mustLoadKeys(t *testing.T, kid, algorithm, secret, keyFile string, retired ...config.JWTKey) {
+	t.Helper()
+	if err := withKeyConfig(t, kid, algorithm, secret, keyFile, retired...); err != nil {
+		t.Fatalf("LoadSigningKeys: %v", err)
+	}
+}
+
+// writePEM writes a PKCS#8 private key or PKIX public key to a file in the test's temp dir
+func writePEM(t *testing.T, name string, key interface{}) string {
+	t.Helper()
+	var block *pem.Block
+	switch key.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tokenKid returns the kid header of a signed token
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestSignedTokensCarryActiveKid(t *testing.T) {
+	mustLoadKeys(t, "2026-01", "HS256", "first-secret", "")
+
+	token, err := GenerateToken(1, "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if kid := tokenKid(t, token); kid != "2026-01" {
+		t.Errorf("kid = %q, want the active key 2026-01", kid)
+	}
+	claims, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != 1 || claims.Role != "user" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestRetiredKeysVerifyDuringGracePeriod(t *testing.T) {
+	mustLoadKeys(t, "old", "HS256", "old-secret", "")
+	oldToken, err := GenerateToken(1, "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		retired []config.JWTKey
+		valid   bool
+	}{
+		{"retired key in its grace period", []config.JWTKey{{ID: "old", Algorithm: "HS256", Secret: "old-secret", ExpiresAt: time.Now().Add(time.Hour)}}, true},
+		{"retired key past its grace period", []config.JWTKey{{ID: "old", Algorithm: "HS256", Secret: "old-secret", ExpiresAt: time.Now().Add(-time.Minute)}}, false},
+		{"key no longer configured", nil, false},
+		{"kid reused with another secret", []config.JWTKey{{ID: "old", Algorithm: "HS256", Secret: "other-secret", ExpiresAt: time.Now().Add(time.Hour)}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mustLoadKeys(t, "new", "HS256", "new-secret", "", tt.retired...)
+			_, err := ValidateToken(oldToken)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateToken: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("token signed with the old key is still accepted")
+			}
+
+			// New tokens are always signed with the active key
+			token, err := GenerateToken(1, "user")
+			if err != nil {
+				t.Fatalf("GenerateToken: %v", err)
+			}
+			if kid := tokenKid(t, token); kid != "new" {
+				t.Errorf("new token signed with kid %q", kid)
+			}
+		})
+	}
+}
+
+func TestUnknownKidIsRejected(t *testing.T) {
+	mustLoadKeys(t, "other", "HS256", "shared-secret", "")
+	token, err := GenerateToken(1, "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// Same secret, but the kid does not name a configured key
+	mustLoadKeys(t, "primary", "HS256", "shared-secret", "")
+	if _, err := ValidateToken(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("ValidateToken error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestTokenWithoutKidUsesActiveKey(t *testing.T) {
+	mustLoadKeys(t, "primary", "HS256", "secret", "")
+
+	claims := &Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   SubjectAccess,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(token); err != nil {
+		t.Errorf("token issued before key rotation was rejected: %v", err)
+	}
+}
+
+func TestAsymmetricKeysSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		algorithm string
+		key       interface{}
+	}{
+		{"RS256", rsaKey},
+		{"EdDSA", edKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			mustLoadKeys(t, "asym", tt.algorithm, "", writePEM(t, "key.pem", tt.key))
+			token, err := GenerateToken(1, "user")
+			if err != nil {
+				t.Fatalf("GenerateToken: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Method.Alg() != tt.algorithm {
+				t.Errorf("alg = %s, want %s", parsed.Method.Alg(), tt.algorithm)
+			}
+			if _, err := ValidateToken(token); err != nil {
+				t.Errorf("ValidateToken: %v", err)
+			}
+		})
+	}
+}
+
+func TestActiveKeyMustBePrivate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := withKeyConfig(t, "pub", "RS256", "", writePEM(t, "pub.pem", &rsaKey.PublicKey)); err == nil {
+		t.Error("a public key was accepted as the active signing key")
+	}
+	if err := withKeyConfig(t, "x", "ES256", "secret", ""); err == nil {
+		t.Error("an unsupported algorithm was accepted")
+	}
+}
+
+func TestAlgorithmConfusionIsRejected(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := os.ReadFile(writePEM(t, "pub.pem", &rsaKey.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustLoadKeys(t, "rsa", "RS256", "", writePEM(t, "key.pem", rsaKey))
+
+	// An attacker signs an HS256 token using the published RSA public key as the HMAC secret
+	claims := &Claims{UserID: 1, Role: "admin", RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   SubjectAccess,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Error("HS256 token signed with the RSA public key was accepted")
+	}
+}
+
+func TestRetiredPublicKeyVerifies(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustLoadKeys(t, "old", "RS256", "", writePEM(t, "old.pem", oldKey))
+	token, err := GenerateToken(1, "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// After rotation only the public half of the old key needs to be kept
+	_, newKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustLoadKeys(t, "new", "EdDSA", "", writePEM(t, "new.pem", newKey), config.JWTKey{
+		ID: "old", Algorithm: "RS256", KeyFile: writePEM(t, "old-pub.pem", &oldKey.PublicKey), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if _, err := ValidateToken(token); err != nil {
+		t.Errorf("token signed before the rotation was rejected: %v", err)
+	}
+}
+
+func TestPublicJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustLoadKeys(t, "ed", "EdDSA", "", writePEM(t, "ed.pem", edKey),
+		config.JWTKey{ID: "rsa", Algorithm: "RS256", KeyFile: writePEM(t, "rsa.pem", &rsaKey.PublicKey), ExpiresAt: time.Now().Add(time.Hour)},
+		config.JWTKey{ID: "hmac", Algorithm: "HS256", Secret: "secret", ExpiresAt: time.Now().Add(time.Hour)},
+		config.JWTKey{ID: "expired", Algorithm: "RS256", KeyFile: writePEM(t, "expired.pem", &expiredKey.PublicKey), ExpiresAt: time.Now().Add(-time.Minute)},
+	)
+
+	set := PublicJWKS()
+	byKid := map[string]JWK{}
+	for _, k := range set.Keys {
+		byKid[k.Kid] = k
+	}
+	if len(set.Keys) != 2 {
+		t.Errorf("JWKS has %d keys (%v), want the Ed25519 and RSA keys", len(set.Keys), byKid)
+	}
+	if _, ok := byKid["hmac"]; ok {
+		t.Error("HMAC secret is published")
+	}
+	if _, ok := byKid["expired"]; ok {
+		t.Error("expired retired key is published")
+	}
+
+	ed := byKid["ed"]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); !edPub.Equal(ed25519.PublicKey(x)) {
+		t.Error("Ed25519 JWK does not encode the public key")
+	}
+
+	r := byKid["rsa"]
+	if r.Kty != "RSA" || r.Alg != "RS256" || r.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", r)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(r.N)
+	e, _ := base64.RawURLEncoding.DecodeString(r.E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !rsaKey.PublicKey.Equal(pub) {
+		t.Error("RSA JWK does not encode the public key")
+	}
+}
+
+func TestPublicJWKSIsEmptyForHMAC(t *testing.T) {
+	mustLoadKeys(t, "primary", "HS256", "secret", "")
+	if set := PublicJWKS(); set.Keys == nil || len(set.Keys) != 0 {
+		t.Errorf("JWKS for an HMAC key = %+v, want an empty key list", set)
+	}
+}
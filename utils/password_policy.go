@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"gocheck/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// PasswordViolation describes one policy rule a password failed
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password violated
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+// MaxPasswordLength caps passwords in bytes. bcrypt cannot hash more than 72
+// bytes, and longer inputs would only make every Argon2 hash more expensive.
+// Request bindings use the same number with max=, which counts characters.
+const MaxPasswordLength = 72
+
+// PasswordPolicy is the set of rules new passwords must satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BreachedPath is an offline breached-password list: either a directory of
+	// k-anonymity range files (named by the first 5 hex chars of the SHA-1, each
+	// line "SUFFIX:COUNT") or a single file of full SHA-1 hashes, one per line.
+	BreachedPath string
+}
+
+// CurrentPasswordPolicy returns the policy described by config.AppConfig
+func CurrentPasswordPolicy() PasswordPolicy {
+	cfg := config.AppConfig.PasswordPolicy
+	return PasswordPolicy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+		BreachedPath:  cfg.BreachedPath,
+	}
+}
+
+// ValidatePassword checks a password against the configured policy
+func ValidatePassword(password string, identifiers ...string) error {
+	return CurrentPasswordPolicy().Validate(password, identifiers...)
+}
+
+// Validate checks password against every rule and returns a *PasswordPolicyError
+// listing all violations, or nil. Identifiers are values such as the username
+// and email address that must not appear in the password.
+func (p PasswordPolicy) Validate(password string, identifiers ...string) error {
+	var violations []PasswordViolation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PasswordViolation{"min_length", fmt.Sprintf("must be at least %d characters long", p.MinLength)})
+	}
+	if len(password) > MaxPasswordLength {
+		violations = append(violations, PasswordViolation{"max_length", fmt.Sprintf("must be at most %d bytes long", MaxPasswordLength)})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, PasswordViolation{"uppercase", "must contain an uppercase letter"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, PasswordViolation{"lowercase", "must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{"digit", "must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{"symbol", "must contain a symbol"})
+	}
+
+	if containsIdentifier(password, identifiers) {
+		violations = append(violations, PasswordViolation{"personal_info", "must not contain your username or email address"})
+	}
+
+	if p.BreachedPath != "" {
+		breached, err := isBreached(p.BreachedPath, password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached password list: %w", err)
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{"breached", "has appeared in a data breach; choose a different password"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsIdentifier reports whether the password contains any identifier, or the
+// local part of an email identifier, ignoring case. Very short values are skipped.
+func containsIdentifier(password string, identifiers []string) bool {
+	lower := strings.ToLower(password)
+	for _, id := range identifiers {
+		id = strings.ToLower(strings.TrimSpace(id))
+		candidates := []string{id}
+		if at := strings.Index(id, "@"); at > 0 {
+			candidates = append(candidates, id[:at])
+		}
+		for _, c := range candidates {
+			if len(c) >= 3 && strings.Contains(lower, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isBreached looks the password's SHA-1 up in the offline breached-password list
+func isBreached(path, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Range directory: only the file for the 5-character prefix is read
+	if info.IsDir() {
+		prefix, suffix := hash[:5], hash[5:]
+		for _, name := range []string{prefix, prefix + ".txt"} {
+			found, err := scanHashFile(filepath.Join(path, name), suffix)
+			if os.IsNotExist(err) {
+				continue
+			}
+			return found, err
+		}
+		return false, nil
+	}
+
+	return scanHashFile(path, hash)
+}
+
+// scanHashFile reports whether any line of the file starts with want (before an optional ":count")
+func scanHashFile(path, want string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, want) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// violatedRules returns the rules reported by a *PasswordPolicyError
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("error %v is not a *PasswordPolicyError", err)
+	}
+	rules := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		rules[i] = v.Rule
+	}
+	return rules
+}
+
+func TestPasswordPolicyRules(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		want     []string
+	}{
+		{"meets every rule", strict, "Correct-Horse-9", nil},
+		{"too short", strict, "Short-9a", []string{"min_length"}},
+		{"length counts characters, not bytes", PasswordPolicy{MinLength: 4}, "äöüß", nil},
+		{"no uppercase", strict, "correct-horse-9", []string{"uppercase"}},
+		{"no lowercase", strict, "CORRECT-HORSE-9", []string{"lowercase"}},
+		{"no digit", strict, "Correct-Horse-X", []string{"digit"}},
+		{"no symbol", strict, "CorrectHorse99", []string{"symbol"}},
+		{"space counts as a symbol", strict, "Correct Horse 9", nil},
+		{"every violation is listed", strict, "abc", []string{"min_length", "uppercase", "digit", "symbol"}},
+		{"rules off by default", PasswordPolicy{MinLength: 8}, "alllowercase", nil},
+		{"at the maximum length", PasswordPolicy{MinLength: 8}, strings.Repeat("a", MaxPasswordLength), nil},
+		{"too long", PasswordPolicy{MinLength: 8}, strings.Repeat("a", MaxPasswordLength+1), []string{"max_length"}},
+		{"maximum counts bytes, not characters", PasswordPolicy{MinLength: 8}, strings.Repeat("ä", MaxPasswordLength/2+1), []string{"max_length"}},
+	}
+	for _, tt := range tests {
+		got := violatedRules(t, tt.policy.Validate(tt.password))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyRejectsPersonalInfo(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8}
+	tests := []struct {
+		password string
+		reject   bool
+	}{
+		{"my-Alice99-password", true},      // username, ignoring case
+		{"wonderland-forever", true},       // local part of the email address
+		{"x-wonderland@example.com", true}, // whole email address
+		{"completely-unrelated", false},
+		{"ab-is-too-short-to-match", false},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.password, "alice99", "wonderland@example.com", "ab")
+		rejected := len(violatedRules(t, err)) > 0
+		if rejected != tt.reject {
+			t.Errorf("%q: rejected = %v, want %v", tt.password, rejected, tt.reject)
+		}
+	}
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPasswordPolicyBreachedList(t *testing.T) {
+	breached := "Password123!"
+	hash := sha1Hex(breached)
+
+	// Range directory in the format of the k-anonymity API: one file per prefix
+	rangeDir := t.TempDir()
+	content := "0000000000000000000000000000000000A:3\n" + hash[5:] + ":52256179\n"
+	if err := os.WriteFile(filepath.Join(rangeDir, hash[:5]), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Single file of full hashes, in lowercase to check case-insensitive matching
+	hashFile := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(hashFile, []byte(strings.ToLower(hash)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{"range directory": rangeDir, "hash file": hashFile} {
+		policy := PasswordPolicy{MinLength: 8, BreachedPath: path}
+		if got := violatedRules(t, policy.Validate(breached)); len(got) != 1 || got[0] != "breached" {
+			t.Errorf("%s: violations for a breached password = %v, want [breached]", name, got)
+		}
+		// A password whose prefix has no range file is simply not breached
+		if err := policy.Validate("Unlisted-Password-42"); err != nil {
+			t.Errorf("%s: unlisted password rejected: %v", name, err)
+		}
+	}
+}
+
+func TestPasswordPolicyMissingBreachedListFails(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, BreachedPath: filepath.Join(t.TempDir(), "missing")}
+	err := policy.Validate("Some-Password-1")
+	if err == nil {
+		t.Fatal("a missing breached-password list was ignored")
+	}
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		t.Errorf("a missing list is reported as a policy violation: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownScope is returned when a credential requests a scope that does not exist
+var ErrUnknownScope = errors.New("unknown scope")
+
+// KnownScopes are the scopes a token or API key can be limited to. A token
+// without a scope claim is not limited beyond its user's own permissions.
+var KnownScopes = []string{"books:read", "books:write", "users:read", "users:write", "users:admin"}
+
+// NormalizeScopes validates scopes against KnownScopes and removes duplicates
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	var result []string
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// ParseScope splits and validates a space-separated scope string, as used by the
+// "scope" claim and request parameter
+func ParseScope(scope string) ([]string, error) {
+	return NormalizeScopes(strings.Fields(scope))
+}
+
+// FormatScope joins scopes into a space-separated scope string
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// ScopesAllowed reports whether every requested scope is also granted
+func ScopesAllowed(requested, granted []string) bool {
+	for _, r := range requested {
+		found := false
+		for _, g := range granted {
+			if r == g {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 Appendix B test vectors for SHA-1. The RFC lists 8-digit codes; a
+// 6-digit code is the same value modulo 10^6, i.e. its last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfc6238Vectors {
+		if got := totpCode(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPAcceptsVectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("code %s rejected at %d", v.code, v.unix)
+			continue
+		}
+		if step != v.unix/totpPeriod {
+			t.Errorf("code %s matched step %d, want %d", v.code, step, v.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPDriftWindow(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		code := totpCode(key, current+tt.offset)
+		step, ok := ValidateTOTP(rfc6238Secret, code, now)
+		if ok != tt.ok {
+			t.Errorf("code %d steps away: ok = %v, want %v", tt.offset, ok, tt.ok)
+		}
+		if ok && step != current+tt.offset {
+			t.Errorf("code %d steps away matched step %d, want %d", tt.offset, step, current+tt.offset)
+		}
+	}
+}
+
+func TestValidateTOTPReturnsStepForReplayCheck(t *testing.T) {
+	// The same code stays valid for its whole window; callers reject a replay by
+	// refusing steps at or before the last one they accepted
+	now := time.Unix(1111111109, 0)
+	first, ok := ValidateTOTP(rfc6238Secret, "081804", now)
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	again, ok := ValidateTOTP(rfc6238Secret, "081804", now.Add(20*time.Second))
+	if !ok || again != first {
+		t.Errorf("replayed code matched step %d (ok %v), want the same step %d", again, ok, first)
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfc6238Secret, "287083"},
+		{"too short", rfc6238Secret, "28708"},
+		{"too long", rfc6238Secret, "2870822"},
+		{"8 digits", rfc6238Secret, "94287082"},
+		{"empty", rfc6238Secret, ""},
+		{"bad secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+			t.Errorf("%s: code accepted", tt.name)
+		}
+	}
+
+	// Whitespace and a lowercase secret, as typed or pasted by users, are fine
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), " 287082 ", now); !ok {
+		t.Error("code with surrounding spaces or lowercase secret rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	if other, _ := GenerateTOTPSecret(); other == secret {
+		t.Error("two secrets are equal")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+		if got := NormalizeRecoveryCode(" " + strings.ToUpper(strings.Replace(code, "-", " ", 1)) + " "); got != code {
+			t.Errorf("NormalizeRecoveryCode of a retyped %q = %q", code, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import "strings"
+
+// userAgentClients maps User-Agent markers to a client name. Order matters:
+// Edge and Opera also claim to be Chrome, and Chrome also claims to be Safari.
+var userAgentClients = []struct{ marker, name string }{
+	{"edg/", "Edge"},
+	{"opr/", "Opera"},
+	{"firefox/", "Firefox"},
+	{"chrome/", "Chrome"},
+	{"crios/", "Chrome"},
+	{"fxios/", "Firefox"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+	{"postmanruntime/", "Postman"},
+	{"go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python requests"},
+}
+
+// userAgentPlatforms maps User-Agent markers to an operating system. iOS and
+// Android come first because their agents also mention Mac OS X and Linux.
+var userAgentPlatforms = []struct{ marker, name string }{
+	{"iphone", "iPhone"},
+	{"ipad", "iPad"},
+	{"android", "Android"},
+	{"windows", "Windows"},
+	{"mac os x", "macOS"},
+	{"cros", "ChromeOS"},
+	{"linux", "Linux"},
+}
+
+// DeviceLabel turns a User-Agent header into a short human-readable label such
+// as "Firefox on Linux", good enough for a user to recognise their devices
+func DeviceLabel(userAgent string) string {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	client := ""
+	for _, c := range userAgentClients {
+		if strings.Contains(ua, c.marker) {
+			client = c.name
+			break
+		}
+	}
+	platform := ""
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(ua, p.marker) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case client != "" && platform != "":
+		return client + " on " + platform
+	case client != "":
+		return client
+	case platform != "":
+		return "Browser on " + platform
+	}
+	// Unknown agent: show its product token, e.g. "MyApp" from "MyApp/1.2 (build 7)"
+	label := strings.Fields(userAgent)[0]
+	if i := strings.Index(label, "/"); i > 0 {
+		label = label[:i]
+	}
+	if len(label) > 100 {
+		label = label[:100]
+	}
+	return label
+}